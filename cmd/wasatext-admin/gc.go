@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/donnim1/WASAText/service/mediagc"
+)
+
+// gcMedia deletes the stored files nothing refers to, see package mediagc.
+func gcMedia(e env, args []string) error {
+	fs := flag.NewFlagSet("gc-media", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report the files that would be deleted")
+	grace := fs.Duration("grace", mediagc.DefaultGrace, "minimum age of the files deleted")
+	verbose := fs.Bool("v", false, "list the files")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *grace <= 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "-grace must be positive")
+		return errUsage
+	}
+
+	report, err := mediagc.Collect(e.db, e.store, mediagc.Options{Grace: *grace, DryRun: *dryRun})
+	if *verbose || *dryRun {
+		for _, f := range report.Orphans {
+			fmt.Printf("%s\t%d\t%s\n", f.Name, f.Size, f.ModTime.UTC().Format("2006-01-02T15:04:05Z")) //nolint:forbidigo
+		}
+	}
+	fmt.Println(report) //nolint:forbidigo
+	return err
+}
@@ -0,0 +1,103 @@
+/*
+Wasatext-admin runs maintenance tasks on the WASAText database and stored files. It may run while the web API is
+serving requests.
+
+Usage:
+
+	wasatext-admin [flags] <command> [command flags]
+
+The flags are:
+
+	-db <path>
+		The SQLite database, as in the DB.Filename setting of webapi. Default /tmp/decaf.db.
+	-uploads <dir>
+		The directory holding the stored files, served at /uploads/. Default "uploads".
+
+The commands are:
+
+	gc-media [-dry-run] [-grace <duration>] [-v]
+		Delete the stored files nothing refers to that are older than the grace period (default 24h), and print
+		what was deleted. With -dry-run, only print what would be.
+
+	migrate-inline-media [-dry-run] [-batch <n>] [-v]
+		Move the base64 images stored in message contents to the uploads directory, storing identical images
+		once, and rewrite the messages as image messages. Print the bytes reclaimed. Run it again to resume.
+
+Return values (exit codes):
+
+	0
+		The command was successful
+
+	1
+		The command failed
+
+	2
+		The command line is invalid
+*/
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/donnim1/WASAText/service/storage"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// env holds what the commands work on.
+type env struct {
+	db    database.AppDatabase
+	store storage.Backend
+}
+
+// commands maps command names to their implementation, which parses its own arguments.
+var commands = map[string]func(e env, args []string) error{
+	"gc-media":             gcMedia,
+	"migrate-inline-media": migrateInlineMedia,
+}
+
+// errUsage is returned by commands given invalid arguments, after the flag package printed the usage.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	dbFile := flag.String("db", "/tmp/decaf.db", "SQLite database file")
+	uploads := flag.String("uploads", "uploads", "directory of the stored files")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "Usage: wasatext-admin [flags] <command> [command flags]")
+		_, _ = fmt.Fprintln(flag.CommandLine.Output(), "Commands: gc-media, migrate-inline-media")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*dbFile, *uploads, command, flag.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		_, _ = fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// run opens the database and calls the command.
+func run(dbFile, uploads string, command func(env, []string) error, args []string) error {
+	dbconn, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		return fmt.Errorf("opening SQLite: %w", err)
+	}
+	defer dbconn.Close()
+	db, err := database.New(dbconn)
+	if err != nil {
+		return fmt.Errorf("creating AppDatabase: %w", err)
+	}
+	return command(env{db: db, store: storage.NewDir(uploads, "/uploads/")}, args)
+}
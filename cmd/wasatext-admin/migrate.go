@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"net/http"
+	"strings"
+
+	"github.com/donnim1/WASAText/service/database"
+
+	// Decoders for image.DecodeConfig.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// inlineImageTypes maps the image types moved to storage to their extension. Other inline images, SVG in
+// particular, are left in the database rather than served from the uploads directory.
+var inlineImageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// migrationStats counts what migrateInlineMedia did.
+type migrationStats struct {
+	scanned, migrated, skipped, changed int
+	filesStored                         int
+	inlineBytes, storedBytes            int64
+}
+
+// migrateInlineMedia moves the base64 images stored in message contents to storage and rewrites the messages as image
+// messages pointing to them. Files are named after the hash of their content, so identical images are stored once.
+// Each message is rewritten in its own short transaction, and only if unchanged, so the web API can keep serving
+// requests; an interrupted run is resumed by running the command again. Files stored for messages that changed
+// meanwhile are left to gc-media.
+func migrateInlineMedia(e env, args []string) error {
+	fs := flag.NewFlagSet("migrate-inline-media", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be migrated")
+	batch := fs.Int("batch", 50, "number of messages read at once")
+	verbose := fs.Bool("v", false, "list the messages that are skipped")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *batch < 1 {
+		return errUsage
+	}
+
+	var stats migrationStats
+	stored := make(map[string]bool)
+	var after int64
+	for {
+		images, err := e.db.ListInlineImages(after, *batch)
+		if err != nil {
+			return err
+		}
+		for _, img := range images {
+			after = img.RowID
+			stats.scanned++
+			if err := migrateInlineImage(e, img, *dryRun, stored, &stats); err != nil {
+				var skip errSkip
+				if !errors.As(err, &skip) {
+					printMigrationStats(stats, *dryRun)
+					return fmt.Errorf("message %s: %w", img.MessageID, err)
+				}
+				stats.skipped++
+				if *verbose {
+					fmt.Printf("skipped %s: %v\n", img.MessageID, skip.reason) //nolint:forbidigo
+				}
+			}
+		}
+		if len(images) < *batch {
+			break
+		}
+	}
+	printMigrationStats(stats, *dryRun)
+	return nil
+}
+
+// errSkip marks an inline image that is left in place.
+type errSkip struct{ reason string }
+
+func (e errSkip) Error() string { return e.reason }
+
+// migrateInlineImage moves one image to storage, unless dryRun is set. stored holds the names written in this run.
+func migrateInlineImage(e env, img database.InlineImage, dryRun bool, stored map[string]bool, stats *migrationStats) error {
+	data, err := decodeDataURL(img.Content)
+	if err != nil {
+		return errSkip{err.Error()}
+	}
+	mimeType := http.DetectContentType(data)
+	ext, ok := inlineImageTypes[mimeType]
+	if !ok {
+		return errSkip{"unsupported content " + mimeType}
+	}
+	var width, height int
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		width, height = cfg.Width, cfg.Height
+	}
+
+	sum := sha256.Sum256(data)
+	name := "images/" + hex.EncodeToString(sum[:]) + ext
+	url := e.store.URL(name)
+	if !stored[name] {
+		// The file is written even if an earlier run stored it: the new modification time keeps gc-media from
+		// deleting it before the message refers to it.
+		exists, err := e.db.AttachmentURLExists(url)
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			if _, err := e.store.Put(name, bytes.NewReader(data)); err != nil {
+				return err
+			}
+		}
+		if !exists {
+			stats.filesStored++
+			stats.storedBytes += int64(len(data))
+		}
+		stored[name] = true
+	}
+
+	if dryRun {
+		stats.migrated++
+		stats.inlineBytes += int64(len(img.Content))
+		return nil
+	}
+	id, err := database.GenerateNewID()
+	if err != nil {
+		return err
+	}
+	replaced, err := e.db.ReplaceInlineImage(img, database.Attachment{
+		ID:         id,
+		UploaderID: img.SenderID,
+		URL:        url,
+		Name:       "image" + ext,
+		MimeType:   mimeType,
+		Size:       int64(len(data)),
+	}, width, height)
+	if err != nil {
+		return err
+	}
+	if !replaced {
+		stats.changed++
+		return nil
+	}
+	stats.migrated++
+	stats.inlineBytes += int64(len(img.Content))
+	return nil
+}
+
+// decodeDataURL returns the content of a base64 data URL.
+func decodeDataURL(s string) ([]byte, error) {
+	comma := strings.IndexByte(s, ',')
+	if !strings.HasPrefix(s, "data:") || comma < 0 || !strings.HasSuffix(s[:comma], ";base64") {
+		return nil, errors.New("not a base64 data URL")
+	}
+	encoded := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+			return -1
+		}
+		return r
+	}, s[comma+1:])
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return data, nil
+}
+
+func printMigrationStats(s migrationStats, dryRun bool) {
+	verb := "migrated"
+	if dryRun {
+		verb = "would migrate"
+	}
+	fmt.Printf("scanned %d messages: %s %d, skipped %d, changed meanwhile %d\n", //nolint:forbidigo
+		s.scanned, verb, s.migrated, s.skipped, s.changed)
+	fmt.Printf("removed %d bytes of inline images, stored %d files (%d bytes): %d bytes reclaimed\n", //nolint:forbidigo
+		s.inlineBytes, s.filesStored, s.storedBytes, s.inlineBytes-s.storedBytes)
+	if !dryRun && s.migrated > 0 {
+		fmt.Println("run VACUUM on the database, while the web API is stopped, to shrink the file") //nolint:forbidigo
+	}
+}
@@ -9,8 +9,9 @@ import (
 // applyCORSHandler applies a CORS policy to the router.
 func applyCORSHandler(h http.Handler) http.Handler {
 	return handlers.CORS(
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Requested-With"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Requested-With", "Upload-Offset"}),
+		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "DELETE", "PUT", "PATCH", "HEAD"}),
+		handlers.ExposedHeaders([]string{"Location", "Upload-Offset", "Upload-Length"}),
 		handlers.AllowedOrigins([]string{"*"}), // Allow requests from any origin (frontend)
 		handlers.AllowCredentials(),
 		handlers.MaxAge(1),
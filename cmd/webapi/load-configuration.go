@@ -28,6 +28,10 @@ type WebAPIConfiguration struct {
 	DB    struct {
 		Filename string `conf:"default:/tmp/decaf.db"`
 	}
+	Media struct {
+		// GCGrace is how long unreferenced uploads are kept; negative disables the collector.
+		GCGrace time.Duration `conf:"default:24h"`
+	}
 }
 
 // loadConfiguration creates a WebAPIConfiguration starting from flags, environment variables and configuration file.
@@ -112,8 +112,9 @@ func run() error {
 
 	// Create the API router
 	apirouter, err := api.New(api.Config{
-		Logger:   logger,
-		Database: db,
+		Logger:       logger,
+		Database:     db,
+		MediaGCGrace: cfg.Media.GCGrace,
 	})
 	if err != nil {
 		logger.WithError(err).Error("error creating the API server instance")
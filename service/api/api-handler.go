@@ -12,19 +12,73 @@ func (rt *_router) Handler() http.Handler {
 
 	rt.router.PUT("/user/username", rt.wrap(rt.setMyUserName))
 	rt.router.PUT("/user/photo", rt.wrap(rt.setMyPhoto))
+	rt.router.GET("/user/privacy", rt.wrap(rt.getPrivacySettings))
+	rt.router.PUT("/user/privacy", rt.wrap(rt.updatePrivacySettings))
 
 	rt.router.GET("/users", rt.wrap(rt.listUsers))
+	rt.router.GET("/users/:userId/vcard", rt.wrap(rt.exportUserVCard))
+	rt.router.POST("/users/:userId/block", rt.wrap(rt.blockUser))
+	rt.router.DELETE("/users/:userId/block", rt.wrap(rt.unblockUser))
+	rt.router.GET("/user/blocked", rt.wrap(rt.listBlockedUsers))
+	rt.router.GET("/contacts", rt.wrap(rt.listContacts))
+	rt.router.POST("/contacts", rt.wrap(rt.saveContact))
+	rt.router.DELETE("/contacts/:userId", rt.wrap(rt.deleteContact))
+	rt.router.GET("/requests", rt.wrap(rt.listMessageRequests))
+	rt.router.POST("/requests/:conversationId/accept", rt.wrap(rt.acceptMessageRequest))
+	rt.router.POST("/requests/:conversationId/decline", rt.wrap(rt.declineMessageRequest))
 	rt.router.GET("/conversationsfor/:receiverId", rt.wrap(rt.GetConversationByReceiver))
 	rt.router.GET("/conversation/myconversations", rt.wrap(rt.getMyConversations))
 	rt.router.GET("/conversations/:conversationId", rt.wrap(rt.getConversation))
+	rt.router.GET("/conversations/:conversationId/pins", rt.wrap(rt.listPinnedMessages))
+	rt.router.POST("/conversations/:conversationId/pins/:messageId", rt.wrap(rt.pinMessage))
+	rt.router.DELETE("/conversations/:conversationId/pins/:messageId", rt.wrap(rt.unpinMessage))
+	rt.router.PUT("/conversations/:conversationId/ttl", rt.wrap(rt.setMessageTTL))
+	rt.router.GET("/conversations/:conversationId/draft", rt.wrap(rt.getDraft))
+	rt.router.PUT("/conversations/:conversationId/draft", rt.wrap(rt.saveDraft))
+	rt.router.DELETE("/conversations/:conversationId/draft", rt.wrap(rt.deleteDraft))
+	rt.router.GET("/conversations/:conversationId/sticker-packs", rt.wrap(rt.listSharedStickerPacks))
+	rt.router.POST("/conversations/:conversationId/sticker-packs", rt.wrap(rt.shareStickerPack))
+
+	rt.router.POST("/media/audio", rt.wrap(rt.uploadAudio))
+	rt.router.POST("/media/uploads", rt.wrap(rt.createUpload))
+	rt.router.HEAD("/media/uploads/:uploadId", rt.wrap(rt.getUploadStatus))
+	rt.router.PATCH("/media/uploads/:uploadId", rt.wrap(rt.uploadChunk))
+	rt.router.DELETE("/media/uploads/:uploadId", rt.wrap(rt.deleteUpload))
+	rt.router.POST("/media/uploads/:uploadId/finalize", rt.wrap(rt.finalizeUpload))
+
+	// Sticker packs
+	rt.router.POST("/sticker-packs", rt.wrap(rt.createStickerPack))
+	rt.router.GET("/sticker-packs/:packId", rt.wrap(rt.getStickerPack))
+	rt.router.POST("/sticker-packs/:packId/stickers", rt.wrap(rt.addSticker))
+	rt.router.DELETE("/sticker-packs/:packId/stickers/:stickerId", rt.wrap(rt.deleteSticker))
+	rt.router.GET("/user/sticker-packs", rt.wrap(rt.listInstalledStickerPacks))
+	rt.router.PUT("/user/sticker-packs/:packId", rt.wrap(rt.installStickerPack))
+	rt.router.DELETE("/user/sticker-packs/:packId", rt.wrap(rt.uninstallStickerPack))
+	rt.router.GET("/stickers/search", rt.wrap(rt.searchStickers))
 
 	rt.router.POST("/messages", rt.wrap(rt.sendMessage))
 	rt.router.POST("/messages/:messageId/forward", rt.wrap(rt.forwardMessage))
+	rt.router.POST("/messages/:messageId/votes", rt.wrap(rt.votePoll))
+	rt.router.GET("/messages/:messageId/location", rt.wrap(rt.getLiveLocation))
+	rt.router.PUT("/messages/:messageId/location", rt.wrap(rt.updateLiveLocation))
 
-	rt.router.POST("/messages/:messageId/comments", rt.wrap(rt.commentMessage))
-	rt.router.DELETE("/messages/:messageId/uncomment", rt.wrap(rt.uncommentMessage))
+	rt.router.POST("/messages/:messageId/comments", rt.wrap(rt.addComment))
+	rt.router.PUT("/messages/:messageId/comments/:commentId", rt.wrap(rt.editComment))
+	rt.router.DELETE("/messages/:messageId/comments/:commentId", rt.wrap(rt.deleteComment))
+	rt.router.GET("/messages/:messageId/reactions", rt.wrap(rt.listReactions))
+	rt.router.POST("/messages/:messageId/reactions", rt.wrap(rt.addReaction))
+	rt.router.DELETE("/messages/:messageId/reactions/:emoji", rt.wrap(rt.removeReaction))
+	rt.router.DELETE("/messages/:messageId/uncomment", rt.wrap(rt.removeReactions))
 	rt.router.DELETE("/messages/:messageId", rt.wrap(rt.deleteMessage))
 	rt.router.POST("/messages/:messageId/status/:status", rt.wrap(rt.updateMessageStatus))
+	rt.router.POST("/messages/:messageId/star", rt.wrap(rt.starMessage))
+	rt.router.DELETE("/messages/:messageId/star", rt.wrap(rt.unstarMessage))
+	rt.router.GET("/starred", rt.wrap(rt.listStarredMessages))
+
+	// Scheduled messages
+	rt.router.GET("/scheduled", rt.wrap(rt.listScheduledMessages))
+	rt.router.PUT("/scheduled/:scheduledId", rt.wrap(rt.rescheduleMessage))
+	rt.router.DELETE("/scheduled/:scheduledId", rt.wrap(rt.cancelScheduledMessage))
 
 	// Group endpoints
 	rt.router.GET("/groups", rt.wrap(rt.listGroups))
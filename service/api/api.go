@@ -37,10 +37,14 @@ See the `main.go` file inside the `cmd/webapi` for a full usage example.
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/donnim1/WASAText/service/database"
+	"github.com/donnim1/WASAText/service/storage"
+	"github.com/donnim1/WASAText/service/unfurl"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 )
@@ -52,6 +56,16 @@ type Config struct {
 
 	// Database is the instance of database.AppDatabase where data are saved
 	Database database.AppDatabase
+
+	// Unfurler fetches link previews. If nil, previews are fetched over HTTP with the default options.
+	Unfurler unfurl.Unfurler
+
+	// Storage keeps uploaded files. If nil, they are stored in the "uploads" directory served at /uploads/.
+	Storage storage.Backend
+
+	// MediaGCGrace is how long stored files nothing refers to are kept before being deleted. Zero selects
+	// mediagc.DefaultGrace; a negative value disables the collector.
+	MediaGCGrace time.Duration
 }
 
 // Router is the package API interface representing an API handler builder
@@ -79,11 +93,39 @@ func New(cfg Config) (Router, error) {
 	router.RedirectTrailingSlash = false
 	router.RedirectFixedPath = false
 
-	return &_router{
-		router:     router,
-		baseLogger: cfg.Logger,
-		db:         cfg.Database,
-	}, nil
+	unfurler := cfg.Unfurler
+	if unfurler == nil {
+		unfurler = unfurl.NewHTTPUnfurler(unfurl.HTTPOptions{})
+	}
+
+	store := cfg.Storage
+	if store == nil {
+		store = storage.NewDir(uploadsDir, "/"+uploadsDir+"/")
+	}
+
+	rt := &_router{
+		router:       router,
+		baseLogger:   cfg.Logger,
+		db:           cfg.Database,
+		unfurler:     unfurler,
+		storage:      store,
+		mediaGCGrace: cfg.MediaGCGrace,
+	}
+	rt.ctx, rt.cancel = context.WithCancel(context.Background())
+
+	// Start background tasks; they are stopped in Close().
+	rt.tasks = append(rt.tasks,
+		startBackgroundTask(scheduledDispatchInterval, rt.dispatchScheduledMessages),
+		startBackgroundTask(reapInterval, rt.reapExpiredMessages),
+		startBackgroundTask(linkPreviewInterval, rt.fetchLinkPreviews),
+		startBackgroundTask(liveLocationSweepInterval, rt.endExpiredLiveLocations),
+		startBackgroundTask(staleUploadSweepInterval, rt.deleteStaleUploads),
+	)
+	if cfg.MediaGCGrace >= 0 {
+		rt.tasks = append(rt.tasks, startBackgroundTask(mediaGCInterval, rt.collectOrphanedMedia))
+	}
+
+	return rt, nil
 }
 
 type _router struct {
@@ -94,6 +136,30 @@ type _router struct {
 	baseLogger logrus.FieldLogger
 
 	db database.AppDatabase
+
+	unfurler unfurl.Unfurler
+
+	storage storage.Backend
+
+	// mediaGCGrace is passed to mediagc.Collect.
+	mediaGCGrace time.Duration
+
+	// uploads serializes the chunks written to each upload.
+	uploads keyedMutex
+
+	// locations wakes up requests waiting for live location updates.
+	locations locationHub
+
+	// lastSeen throttles the updates of the users' last seen time.
+	lastSeen lastSeenTracker
+
+	// tasks are the background goroutines owned by the router.
+	tasks []*backgroundTask
+
+	// ctx is the parent of the contexts of background work, such as link preview fetches. Close cancels it, so that
+	// the tasks stop without waiting for slow requests.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // Message represents a chat message
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// backgroundTask runs a function periodically in its own goroutine until stopped. Tasks are owned by the `_router`,
+// started in New() and stopped in Close().
+type backgroundTask struct {
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// startBackgroundTask calls run every interval, the first time after one interval has elapsed. Runs never overlap.
+func startBackgroundTask(interval time.Duration, run func()) *backgroundTask {
+	t := &backgroundTask{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+	return t
+}
+
+// Stop asks the task to terminate and waits for the current run, if any, to complete.
+func (t *backgroundTask) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+}
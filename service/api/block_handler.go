@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// blockedUsersResponse defines the JSON response for listing blocked users.
+type blockedUsersResponse struct {
+	Users []database.BlockedUser `json:"users"`
+}
+
+// blockUser handles POST /users/:userId/block.
+func (rt *_router) blockUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := rt.db.BlockUser(userID, ps.ByName("userId")); err != nil {
+		http.Error(w, "Failed to block user: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unblockUser handles DELETE /users/:userId/block.
+func (rt *_router) unblockUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := rt.db.UnblockUser(userID, ps.ByName("userId")); err != nil {
+		http.Error(w, "Failed to unblock user: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBlockedUsers handles GET /user/blocked.
+func (rt *_router) listBlockedUsers(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	users, err := rt.db.GetBlockedUsers(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve blocked users: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(blockedUsersResponse{Users: users}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
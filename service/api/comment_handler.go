@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// commentRequest defines the payload for adding or editing a comment. Reaction is accepted from clients that used
+// this endpoint to react before reactions had their own.
+type commentRequest struct {
+	Content  string `json:"content"`
+	Reaction string `json:"reaction,omitempty"`
+}
+
+// addComment handles POST /messages/:messageId/comments.
+func (rt *_router) addComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Content == "" && req.Reaction != "" {
+		if err := rt.db.AddReaction(messageID, userID, req.Reaction); err != nil {
+			http.Error(w, "Failed to add reaction: "+err.Error(), statusForDBError(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(map[string]string{"message": "Reaction added successfully"}); err != nil {
+			log.Printf("Error encoding response: %v", err)
+		}
+		return
+	}
+
+	comment, err := rt.db.AddComment(messageID, userID, req.Content)
+	if err != nil {
+		http.Error(w, "Failed to add comment: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(comment); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// editComment handles PUT /messages/:messageId/comments/:commentId.
+func (rt *_router) editComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	commentID := ps.ByName("commentId")
+	if messageID == "" || commentID == "" {
+		http.Error(w, "Message ID and comment ID are required", http.StatusBadRequest)
+		return
+	}
+
+	var req commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := rt.db.EditComment(messageID, commentID, userID, req.Content)
+	if err != nil {
+		http.Error(w, "Failed to edit comment: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(comment); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// deleteComment handles DELETE /messages/:messageId/comments/:commentId.
+func (rt *_router) deleteComment(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	commentID := ps.ByName("commentId")
+	if messageID == "" || commentID == "" {
+		http.Error(w, "Message ID and comment ID are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.DeleteComment(messageID, commentID, userID); err != nil {
+		http.Error(w, "Failed to delete comment: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// saveContactRequest defines the payload for adding or updating a contact.
+type saveContactRequest struct {
+	UserID   string `json:"userId"`
+	Nickname string `json:"nickname"`
+	Favorite bool   `json:"favorite"`
+}
+
+// contactsResponse defines the JSON response for listing contacts.
+type contactsResponse struct {
+	Contacts []database.Contact `json:"contacts"`
+}
+
+// saveContact handles POST /contacts. Saving a user already in the contacts list replaces their nickname and
+// favorite flag.
+func (rt *_router) saveContact(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req saveContactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	contact, err := rt.db.SaveContact(userID, req.UserID, req.Nickname, req.Favorite)
+	if err != nil {
+		http.Error(w, "Failed to save contact: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(contact); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// deleteContact handles DELETE /contacts/:userId.
+func (rt *_router) deleteContact(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := rt.db.DeleteContact(userID, ps.ByName("userId")); err != nil {
+		http.Error(w, "Failed to delete contact: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listContacts handles GET /contacts.
+func (rt *_router) listContacts(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	contacts, err := rt.db.GetContacts(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve contacts: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(contactsResponse{Contacts: contacts}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
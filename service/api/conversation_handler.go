@@ -64,6 +64,9 @@ type Conversation struct {
 	LastMessageContent string          `json:"last_message_content"` // Content from the last message
 	LastMessageSentAt  string          `json:"last_message_sent_at"`
 	Members            []database.User `json:"members"`
+	MessageTTL         int             `json:"message_ttl"`        // Disappearing messages TTL in seconds (0 = off)
+	HasDraft           bool            `json:"hasDraft"`           // Whether the user has an unsent draft here
+	LastSeen           string          `json:"lastSeen,omitempty"` // When the partner of a private chat was last active, if they show it
 }
 
 // getMyConversations retrieves all conversations for the authenticated user.
@@ -86,15 +89,20 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, _
 	var apiConversations []Conversation
 	for _, conv := range convs {
 		// For private chats (IsGroup false) with empty name, try to fetch the chat partner’s details.
+		var lastSeen string
 		if conv.Name == "" && !conv.IsGroup {
 			partner, err := rt.db.GetChatPartner(conv.ID, userID)
 			if err == nil && partner != nil {
 				conv.Name = partner.Username
+				if partner.Nickname.Valid {
+					conv.Name = partner.Nickname.String
+				}
 				if partner.PhotoUrl.Valid {
 					conv.PhotoUrl = partner.PhotoUrl.String
 				} else {
 					conv.PhotoUrl = ""
 				}
+				lastSeen = partner.LastSeen.String
 			}
 		}
 
@@ -115,6 +123,8 @@ func (rt *_router) getMyConversations(w http.ResponseWriter, r *http.Request, _
 			PhotoUrl:           conv.PhotoUrl,
 			LastMessageContent: conv.LastMessageContent.String, // New field.
 			LastMessageSentAt:  conv.LastMessageSentAt.String,  // New field.
+			HasDraft:           conv.HasDraft,
+			LastSeen:           lastSeen,
 		})
 		// (If you use sql.Rows in database functions, be sure to check rows.Err() after looping.)
 	}
@@ -146,7 +156,7 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 	}
 
 	// 3. Retrieve conversation details and messages from the database.
-	conv, messages, err := rt.db.GetConversation(conversationID)
+	conv, messages, err := rt.db.GetConversation(conversationID, currentUserId)
 	if err != nil {
 		http.Error(w, "Failed to retrieve conversation: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -157,13 +167,18 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 	}
 
 	// 4. For private chats with an empty name, attempt to fetch the chat partner's details.
+	var lastSeen string
 	if !conv.IsGroup && conv.Name == "" {
 		partner, err := rt.db.GetChatPartner(conv.ID, currentUserId)
 		if err == nil && partner != nil {
 			conv.Name = partner.Username
+			if partner.Nickname.Valid {
+				conv.Name = partner.Nickname.String
+			}
 			if partner.PhotoUrl.Valid {
 				conv.PhotoUrl = partner.PhotoUrl.String
 			}
+			lastSeen = partner.LastSeen.String
 		}
 	}
 
@@ -178,11 +193,13 @@ func (rt *_router) getConversation(w http.ResponseWriter, r *http.Request, ps ht
 
 	// 6. Build the API conversation structure.
 	apiConv := Conversation{
-		ID:        conv.ID,
-		Name:      conv.Name,
-		IsGroup:   conv.IsGroup,
-		CreatedAt: formattedCreatedAt,
-		PhotoUrl:  conv.PhotoUrl,
+		ID:         conv.ID,
+		Name:       conv.Name,
+		IsGroup:    conv.IsGroup,
+		CreatedAt:  formattedCreatedAt,
+		PhotoUrl:   conv.PhotoUrl,
+		MessageTTL: conv.MessageTTL,
+		LastSeen:   lastSeen,
 	}
 
 	// 7. Build and return the response.
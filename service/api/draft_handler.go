@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// saveDraftRequest defines the payload for saving a draft.
+type saveDraftRequest struct {
+	Text        string                     `json:"text"`
+	ReplyTo     string                     `json:"replyTo,omitempty"`
+	Attachments []database.DraftAttachment `json:"attachments,omitempty"`
+}
+
+// saveDraft handles PUT /conversations/:conversationId/draft.
+func (rt *_router) saveDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	if conversationID == "" {
+		http.Error(w, "Conversation ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req saveDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	draft, err := rt.db.SaveDraft(conversationID, userID, database.Draft{
+		Text:        req.Text,
+		ReplyTo:     req.ReplyTo,
+		Attachments: req.Attachments,
+	})
+	if err != nil {
+		http.Error(w, "Failed to save draft: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(draft); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// getDraft handles GET /conversations/:conversationId/draft.
+func (rt *_router) getDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	if conversationID == "" {
+		http.Error(w, "Conversation ID is required", http.StatusBadRequest)
+		return
+	}
+
+	draft, err := rt.db.GetDraft(conversationID, userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve draft: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(draft); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// deleteDraft handles DELETE /conversations/:conversationId/draft.
+func (rt *_router) deleteDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	if conversationID == "" {
+		http.Error(w, "Conversation ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.DeleteDraft(conversationID, userID); err != nil {
+		http.Error(w, "Failed to delete draft: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Draft deleted successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
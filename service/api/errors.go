@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/database"
+)
+
+// statusForDBError maps the errors returned by database.AppDatabase to an HTTP status code.
+func statusForDBError(err error) int {
+	switch {
+	case errors.Is(err, database.ErrNotMember), errors.Is(err, database.ErrNotAdmin),
+		errors.Is(err, database.ErrNotPackOwner), errors.Is(err, database.ErrBlocked):
+		return http.StatusForbidden
+	case errors.Is(err, database.ErrMessageNotFound), errors.Is(err, database.ErrScheduledMessageNotFound),
+		errors.Is(err, database.ErrPollNotFound), errors.Is(err, database.ErrUserNotFound),
+		errors.Is(err, database.ErrReactionNotFound), errors.Is(err, database.ErrCommentNotFound),
+		errors.Is(err, database.ErrDraftNotFound), errors.Is(err, database.ErrLiveLocationNotFound),
+		errors.Is(err, database.ErrUploadNotFound), errors.Is(err, database.ErrAttachmentNotFound),
+		errors.Is(err, database.ErrStickerPackNotFound), errors.Is(err, database.ErrStickerNotFound),
+		errors.Is(err, database.ErrRequestNotFound), errors.Is(err, database.ErrContactNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrPollClosed), errors.Is(err, database.ErrLiveLocationEnded),
+		errors.Is(err, database.ErrUploadOffset):
+		return http.StatusConflict
+	case errors.Is(err, database.ErrInvalidVote), errors.Is(err, database.ErrInvalidContent),
+		errors.Is(err, database.ErrInvalidReaction), errors.Is(err, database.ErrInvalidComment),
+		errors.Is(err, database.ErrInvalidDraft), errors.Is(err, database.ErrInvalidUpload),
+		errors.Is(err, database.ErrInvalidSticker), errors.Is(err, database.ErrInvalidBlock),
+		errors.Is(err, database.ErrInvalidPrivacy), errors.Is(err, database.ErrInvalidContact),
+		errors.Is(err, database.ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrUploadQuota):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, database.ErrTooManyUploads):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
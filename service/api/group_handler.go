@@ -3,11 +3,8 @@ package api
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"time"
 	"github.com/donnim1/WASAText/service/api/reqcontext"
 
@@ -52,6 +49,9 @@ func (rt *_router) listGroups(w http.ResponseWriter, r *http.Request, _ httprout
 			partner, err := rt.db.GetChatPartner(conv.ID, userID)
 			if err == nil && partner != nil {
 				conv.Name = partner.Username
+				if partner.Nickname.Valid {
+					conv.Name = partner.Nickname.String
+				}
 			}
 		}
 		// Parse and format the created_at timestamp.
@@ -281,29 +281,13 @@ func (rt *_router) setGroupPhoto(w http.ResponseWriter, r *http.Request, ps http
 	if err == nil {
 		defer file.Close()
 
-		uploadDir := "uploads/"
-		if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-			log.Printf("❌ Failed to create upload directory: %v", err)
-			http.Error(w, "Server error: cannot create upload directory", http.StatusInternalServerError)
-			return
-		}
-
-		filePath := filepath.Join(uploadDir, header.Filename)
-		out, err := os.Create(filePath)
+		// Store the photo under a new name, so that the previous one is left for the media collector.
+		photoUrl, err := rt.storePhoto(file, header.Filename)
 		if err != nil {
-			log.Printf("❌ Failed to create file: %v", err)
+			log.Printf("❌ Failed to store photo: %v", err)
 			http.Error(w, "Failed to save file", http.StatusInternalServerError)
 			return
 		}
-		defer out.Close()
-
-		if _, err := io.Copy(out, file); err != nil {
-			log.Printf("❌ Failed to write file: %v", err)
-			http.Error(w, "Failed to write file", http.StatusInternalServerError)
-			return
-		}
-
-		photoUrl := fmt.Sprintf("/%s", filepath.ToSlash(filePath))
 		if err := rt.db.SetGroupPhoto(groupID, photoUrl); err != nil {
 			http.Error(w, "Failed to update group photo: "+err.Error(), http.StatusInternalServerError)
 			return
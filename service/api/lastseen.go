@@ -0,0 +1,60 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+// lastSeenResolution is how often the last seen time of an active user is written to the database.
+const lastSeenResolution = time.Minute
+
+// maxLastSeenEntries bounds the number of users lastSeenTracker remembers.
+const maxLastSeenEntries = 10000
+
+// lastSeenTracker remembers when the last seen time of each user was last written, so that busy clients do not
+// cause a write per request. Only users written within lastSeenResolution matter; older entries are evicted when the
+// tracker fills up.
+type lastSeenTracker struct {
+	mu      sync.Mutex
+	written map[string]time.Time
+}
+
+// due reports whether the last seen time of userID should be written at now, and if so records it as written.
+func (t *lastSeenTracker) due(userID string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.written[userID]) < lastSeenResolution {
+		return false
+	}
+	if t.written == nil || len(t.written) >= maxLastSeenEntries {
+		t.evict(now)
+	}
+	t.written[userID] = now
+	return true
+}
+
+// evict forgets the users whose last seen time was written more than lastSeenResolution ago. If most entries are
+// recent it forgets everyone instead, so that eviction stays rare; those users are then written once more.
+func (t *lastSeenTracker) evict(now time.Time) {
+	for userID, at := range t.written {
+		if now.Sub(at) >= lastSeenResolution {
+			delete(t.written, userID)
+		}
+	}
+	if t.written == nil || len(t.written) > maxLastSeenEntries/2 {
+		t.written = make(map[string]time.Time)
+	}
+}
+
+// touchLastSeen records that userID is active. Failures are only logged: the request goes on.
+func (rt *_router) touchLastSeen(userID string) {
+	now := globaltime.Now()
+	if !rt.lastSeen.due(userID, now) {
+		return
+	}
+	if err := rt.db.UpdateLastSeen(userID, now); err != nil {
+		rt.baseLogger.WithError(err).Warning("can't update last seen time")
+	}
+}
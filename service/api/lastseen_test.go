@@ -0,0 +1,55 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLastSeenTrackerDue(t *testing.T) {
+	var tr lastSeenTracker
+	now := time.Date(2025, 2, 6, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		userID string
+		at     time.Time
+		want   bool
+	}{
+		{name: "first request", userID: "a", at: now, want: true},
+		{name: "within resolution", userID: "a", at: now.Add(lastSeenResolution - time.Second), want: false},
+		{name: "other user", userID: "b", at: now, want: true},
+		{name: "after resolution", userID: "a", at: now.Add(lastSeenResolution), want: true},
+	}
+	for _, tt := range tests {
+		if got := tr.due(tt.userID, tt.at); got != tt.want {
+			t.Errorf("%s: due() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLastSeenTrackerBounded(t *testing.T) {
+	var tr lastSeenTracker
+	now := time.Date(2025, 2, 6, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3*maxLastSeenEntries; i++ {
+		tr.due(strconv.Itoa(i), now)
+		if len(tr.written) > maxLastSeenEntries {
+			t.Fatalf("tracker holds %d users, want at most %d", len(tr.written), maxLastSeenEntries)
+		}
+	}
+
+	// Stale entries are evicted before recent ones.
+	tr = lastSeenTracker{}
+	for i := 0; i < maxLastSeenEntries-1; i++ {
+		tr.due(strconv.Itoa(i), now)
+	}
+	later := now.Add(lastSeenResolution)
+	tr.due("recent", later)
+	tr.due("new", later)
+	if len(tr.written) != 2 {
+		t.Errorf("tracker holds %d users after eviction, want 2", len(tr.written))
+	}
+	if tr.due("recent", later) {
+		t.Error("due() = true for a user written in the same instant")
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/donnim1/WASAText/service/database"
+)
+
+const (
+	// linkPreviewInterval is how often the unfurl worker looks for URLs waiting for a preview.
+	linkPreviewInterval = 3 * time.Second
+
+	// linkPreviewBatch is the maximum number of URLs fetched in a single worker run.
+	linkPreviewBatch = 10
+
+	// linkPreviewTimeout bounds the fetch of a single URL.
+	linkPreviewTimeout = 10 * time.Second
+)
+
+// fetchLinkPreviews fetches the previews of URLs queued by SendMessage. Failures are stored too, so that a broken
+// URL is not retried until its cache entry goes stale. Fetches are cancelled when the router is closed.
+func (rt *_router) fetchLinkPreviews() {
+	urls, err := rt.db.GetPendingLinkPreviews(linkPreviewBatch)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("can't load pending link previews")
+		return
+	}
+
+	for _, u := range urls {
+		ctx, cancel := context.WithTimeout(rt.ctx, linkPreviewTimeout)
+		p, err := rt.unfurler.Unfurl(ctx, u)
+		cancel()
+		// A fetch cut short by Close is left pending, to be fetched again after a restart.
+		if rt.ctx.Err() != nil {
+			return
+		}
+
+		preview := database.LinkPreview{URL: u}
+		var failure string
+		if err != nil {
+			rt.baseLogger.WithError(err).WithField("url", u).Debug("link preview fetch failed")
+			failure = err.Error()
+		} else {
+			preview.Title = p.Title
+			preview.Description = p.Description
+			preview.ImageURL = p.ImageURL
+			preview.SiteName = p.SiteName
+		}
+
+		if err := rt.db.SaveLinkPreview(preview, failure); err != nil {
+			rt.baseLogger.WithError(err).WithField("url", u).Error("can't save link preview")
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+const (
+	// liveLocationSweepInterval is how often live locations past their period are ended.
+	liveLocationSweepInterval = 15 * time.Second
+
+	// liveLocationWait is how long GET /messages/:messageId/location waits for an update. It stays below the
+	// server's default write timeout.
+	liveLocationWait = 4 * time.Second
+)
+
+// locationHub wakes up the requests waiting for a live location to change.
+type locationHub struct {
+	mu      sync.Mutex
+	waiters map[string][]chan struct{}
+}
+
+// wait returns a channel that is closed at the next change of the live location of messageID.
+func (h *locationHub) wait(messageID string) <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.waiters == nil {
+		h.waiters = make(map[string][]chan struct{})
+	}
+	ch := make(chan struct{})
+	h.waiters[messageID] = append(h.waiters[messageID], ch)
+	return ch
+}
+
+// cancel forgets a channel returned by wait that was not notified.
+func (h *locationHub) cancel(messageID string, ch <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	waiters := h.waiters[messageID]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(h.waiters, messageID)
+	} else {
+		h.waiters[messageID] = waiters
+	}
+}
+
+// notify wakes up everyone waiting on the live location of messageID.
+func (h *locationHub) notify(messageID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range h.waiters[messageID] {
+		close(ch)
+	}
+	delete(h.waiters, messageID)
+}
+
+// endExpiredLiveLocations ends the live locations whose period is over and tells the members watching them.
+func (rt *_router) endExpiredLiveLocations() {
+	ids, err := rt.db.EndExpiredLiveLocations(globaltime.Now())
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("can't end expired live locations")
+		return
+	}
+	for _, id := range ids {
+		rt.locations.notify(id)
+	}
+	if len(ids) > 0 {
+		rt.baseLogger.WithField("count", len(ids)).Debug("expired live locations ended")
+	}
+}
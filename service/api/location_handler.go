@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// updateLocationRequest defines the payload for moving or stopping a live location.
+type updateLocationRequest struct {
+	database.LocationUpdate
+	Stop bool `json:"stop,omitempty"` // End the live location now; the coordinates are then ignored
+}
+
+// updateLiveLocation handles PUT /messages/:messageId/location.
+func (rt *_router) updateLiveLocation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req updateLocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	var loc database.LiveLocation
+	if req.Stop {
+		loc, err = rt.db.StopLiveLocation(messageID, userID)
+	} else {
+		loc, err = rt.db.UpdateLiveLocation(messageID, userID, req.LocationUpdate)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update location: "+err.Error(), statusForDBError(err))
+		return
+	}
+	rt.locations.notify(messageID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(loc); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// getLiveLocation handles GET /messages/:messageId/location. With ?since set to the updatedAt of the last position
+// seen, the request waits briefly for a newer position before answering, so that clients get updates as they come.
+func (rt *_router) getLiveLocation(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+	since := r.URL.Query().Get("since")
+
+	// Subscribe before reading, so that an update landing in between is not missed.
+	changed := rt.locations.wait(messageID)
+	loc, err := rt.db.GetLiveLocation(messageID, userID)
+	if err == nil && since != "" && loc.UpdatedAt == since && loc.Active() {
+		timer := time.NewTimer(liveLocationWait)
+		select {
+		case <-changed:
+			loc, err = rt.db.GetLiveLocation(messageID, userID)
+		case <-timer.C:
+		case <-r.Context().Done():
+		}
+		timer.Stop()
+	}
+	rt.locations.cancel(messageID, changed)
+	if err != nil {
+		http.Error(w, "Failed to retrieve location: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(loc); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
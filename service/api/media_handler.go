@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/audio"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// uploadsDir is the directory served at /uploads/, where files are stored unless Config.Storage is set.
+const uploadsDir = "uploads"
+
+// maxAudioUploadSize is the maximum size of an uploaded audio file.
+const maxAudioUploadSize = 20 << 20
+
+// uploadAudio handles POST /media/audio. The "audio" form file must be Ogg/Opus or WAV; its duration and waveform
+// are measured here and returned with the attachment, whose url then goes in the payload of an audio message.
+func (rt *_router) uploadAudio(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Leave room for the multipart framing around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioUploadSize+64<<10)
+	file, _, err := r.FormFile("audio")
+	if err != nil {
+		http.Error(w, "An audio file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAudioUploadSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read audio file", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxAudioUploadSize {
+		http.Error(w, "Audio file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	info, err := audio.Probe(data)
+	if errors.Is(err, audio.ErrUnsupported) {
+		http.Error(w, "Unsupported audio format: "+err.Error(), http.StatusUnsupportedMediaType)
+		return
+	} else if err != nil {
+		http.Error(w, "Invalid audio file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if info.Duration > database.MaxAudioDuration {
+		http.Error(w, "Audio longer than "+database.MaxAudioDuration.String(), http.StatusBadRequest)
+		return
+	}
+
+	attachmentID, err := database.GenerateNewID()
+	if err != nil {
+		http.Error(w, "Failed to store audio file", http.StatusInternalServerError)
+		return
+	}
+	name := "audio/" + attachmentID + info.Extension
+	if _, err := rt.storage.Put(name, bytes.NewReader(data)); err != nil {
+		ctx.Logger.WithError(err).Error("can't store audio file")
+		http.Error(w, "Failed to store audio file", http.StatusInternalServerError)
+		return
+	}
+
+	attachment, err := rt.db.CreateAttachment(database.Attachment{
+		ID:         attachmentID,
+		UploaderID: userID,
+		Kind:       database.AttachmentKindAudio,
+		URL:        rt.storage.URL(name),
+		MimeType:   info.MimeType,
+		Size:       int64(len(data)),
+		DurationMs: info.Duration.Milliseconds(),
+		Waveform:   info.Waveform,
+	})
+	if err != nil {
+		if rmErr := rt.storage.Delete(name); rmErr != nil {
+			ctx.Logger.WithError(rmErr).Warning("can't remove audio file of failed upload")
+		}
+		http.Error(w, "Failed to store audio file: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(attachment); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// storePhoto stores an uploaded profile or group photo under a new name and returns its URL.
+func (rt *_router) storePhoto(r io.Reader, filename string) (string, error) {
+	id, err := database.GenerateNewID()
+	if err != nil {
+		return "", err
+	}
+	name := "photos/" + id + storedExtension(filename)
+	if _, err := rt.storage.Put(name, r); err != nil {
+		return "", err
+	}
+	return rt.storage.URL(name), nil
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+	"github.com/donnim1/WASAText/service/mediagc"
+)
+
+// mediaGCInterval is how often stored files nothing refers to are deleted.
+const mediaGCInterval = 6 * time.Hour
+
+// collectOrphanedMedia deletes the stored files that are no longer referenced, see package mediagc.
+func (rt *_router) collectOrphanedMedia() {
+	report, err := mediagc.Collect(rt.db, rt.storage, mediagc.Options{Grace: rt.mediaGCGrace, Now: globaltime.Now()})
+	if err != nil {
+		rt.baseLogger.WithError(err).WithField("deleted", len(report.Orphans)).Error("can't collect orphaned media")
+		return
+	}
+	if len(report.Orphans) > 0 {
+		rt.baseLogger.WithField("count", len(report.Orphans)).WithField("bytes", report.Bytes).Info("orphaned media deleted")
+	}
+}
@@ -2,23 +2,38 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/donnim1/WASAText/service/markup"
 
 	"github.com/julienschmidt/httprouter"
 )
 
 // MessageRequest defines the request format for sending a message.
 type MessageRequest struct {
-	ConversationID string `json:"conversationId"` // Conversation ID
-	ReceiverID     string `json:"receiverId"`     // Receiver ID
-	Content        string `json:"content"`
-	IsGroup        bool   `json:"isGroup"`
-	GroupID        string `json:"groupId"`           // Group ID
-	ReplyTo        string `json:"replyTo,omitempty"` // Optional reply-to field
+	ConversationID string          `json:"conversationId"` // Conversation ID
+	ReceiverID     string          `json:"receiverId"`     // Receiver ID
+	Type           string          `json:"type,omitempty"` // Message type, "text" if empty
+	Content        string          `json:"content"`
+	Format         string          `json:"format,omitempty"`       // How Content is written: "plain" (default) or "markdown"
+	Payload        json.RawMessage `json:"payload,omitempty"`      // Type-specific data, see database.MessageContent
+	AttachmentID   string          `json:"attachmentId,omitempty"` // Uploaded file to send; sets Type and Payload
+	IsGroup        bool            `json:"isGroup"`
+	GroupID        string          `json:"groupId"`           // Group ID
+	ReplyTo        string          `json:"replyTo,omitempty"` // Optional reply-to field
+	SendAt         string          `json:"sendAt,omitempty"`  // Optional RFC3339 time to schedule the message for
+	Poll           *pollRequest    `json:"poll,omitempty"`    // Set to send a poll; Content is then ignored
 }
 
+// maxMessageRequestSize is the maximum size of a MessageRequest body. Files are uploaded separately and only
+// referenced by AttachmentID, so requests hold little more than the content.
+const maxMessageRequestSize = 64 << 10
+
 // MessageResponse defines the response format.
 type MessageResponse struct {
 	MessageID      string `json:"messageId"`
@@ -35,23 +50,58 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, _ httprou
 
 	// Decode request body.
 	var req MessageRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxMessageRequestSize)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
 
-	// Validate required fields.
-	if req.Content == "" || (!req.IsGroup && req.ConversationID == "" && req.ReceiverID == "") {
+	// Validate required fields. Typed messages may leave the content empty to get a default description.
+	if (req.Content == "" && req.Type == "" && req.Poll == nil) || (!req.IsGroup && req.ConversationID == "" && req.ReceiverID == "") {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
+	// Checked here rather than left to Normalize, since markdown content is parsed before that.
+	if len(req.Content) > database.MaxBodyLength {
+		http.Error(w, fmt.Sprintf("Content longer than %d characters", database.MaxBodyLength), http.StatusBadRequest)
+		return
+	}
+
+	if req.Poll != nil {
+		if req.SendAt != "" {
+			http.Error(w, "Polls cannot be scheduled", http.StatusBadRequest)
+			return
+		}
+		rt.sendPoll(w, userID, req)
+		return
+	}
+
+	if req.Type == database.MessageTypePoll || req.Type == database.MessageTypeSystem {
+		http.Error(w, "Message type cannot be sent directly", http.StatusBadRequest)
+		return
+	}
+	if req.Format != "" && req.Format != formatPlain && req.Format != formatMarkdown {
+		http.Error(w, "Unsupported format", http.StatusBadRequest)
+		return
+	}
+
+	// Messages with a send time are stored and sent later by the dispatcher.
+	if req.SendAt != "" {
+		rt.scheduleMessage(w, userID, req)
+		return
+	}
 
 	// Call the updated SendMessage function.
-	messageID, conversationID, err := rt.db.SendMessage(userID, req.ReceiverID, req.Content, req.IsGroup, req.GroupID, req.ConversationID, req.ReplyTo)
+	messageID, conversationID, err := rt.db.SendMessage(userID, req.ReceiverID, req.messageContent(), req.IsGroup, req.GroupID, req.ConversationID, req.ReplyTo)
 	if err != nil {
-		http.Error(w, "Failed to send message: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to send message: "+err.Error(), statusForDBError(err))
 		return
 	}
+	// The draft the message was composed from is done with. Scheduled messages are sent by the dispatcher and leave
+	// the draft alone, since the user may have started another one meanwhile.
+	if err := rt.db.DeleteDraft(conversationID, userID); err != nil && !errors.Is(err, database.ErrDraftNotFound) {
+		ctx.Logger.WithError(err).Warning("can't clear draft")
+	}
 
 	// Return response with both messageId and conversationId.
 	w.Header().Set("Content-Type", "application/json")
@@ -67,9 +117,34 @@ func (rt *_router) sendMessage(w http.ResponseWriter, r *http.Request, _ httprou
 	}
 }
 
-// forwardMessageRequest defines the payload for forwarding a message.
+// Values of MessageRequest.Format.
+const (
+	formatPlain    = "plain"
+	formatMarkdown = "markdown"
+)
+
+// messageContent returns the content of the request. Markdown text is parsed into a plain body and formatting
+// entities, so that no markup is stored in the content. With an attachment, the content is a caption and is kept as is.
+func (req MessageRequest) messageContent() database.MessageContent {
+	content := database.MessageContent{Type: req.Type, Body: req.Content, Payload: req.Payload, AttachmentID: req.AttachmentID}
+	if content.AttachmentID != "" {
+		return content
+	}
+	if req.Format == formatMarkdown && (content.Type == "" || content.Type == database.MessageTypeText) {
+		content.Body, content.Entities = markup.Parse(strings.TrimSpace(req.Content))
+	}
+	return content
+}
+
+// maxForwardTargets is the maximum number of conversations and users a message can be forwarded to at once.
+const maxForwardTargets = 20
+
+// forwardMessageRequest defines the payload for forwarding a message. Either TargetConversationID is set, or the
+// batch fields TargetConversationIDs and TargetUserIDs.
 type forwardMessageRequest struct {
-	TargetConversationID string `json:"targetConversationId"`
+	TargetConversationID  string   `json:"targetConversationId"`
+	TargetConversationIDs []string `json:"targetConversationIds,omitempty"`
+	TargetUserIDs         []string `json:"targetUserIds,omitempty"`
 	// SenderID is removed because we use the token's userID.
 }
 
@@ -93,84 +168,49 @@ func (rt *_router) forwardMessage(w http.ResponseWriter, r *http.Request, ps htt
 		return
 	}
 
-	newMessageID, err := rt.db.ForwardMessage(originalMessageID, req.TargetConversationID, userID)
-	if err != nil {
-		http.Error(w, "Failed to forward message: "+err.Error(), http.StatusInternalServerError)
+	if len(req.TargetConversationIDs) > 0 || len(req.TargetUserIDs) > 0 {
+		rt.forwardMessageToMany(w, originalMessageID, userID, req)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(map[string]string{"messageId": newMessageID}); err != nil {
-		log.Printf("Error encoding response: %v", err)
-	}
-}
-
-// commentMessageRequest defines the payload for commenting (reacting) on a message.
-type commentMessageRequest struct {
-	Reaction string `json:"reaction"`
-}
-
-func (rt *_router) commentMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	// Get authenticated user ID.
-	userID, err := rt.getAuthenticatedUserID(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	messageID := ps.ByName("messageId")
-	if messageID == "" {
-		http.Error(w, "Message ID is required", http.StatusBadRequest)
-		return
-	}
-
-	// Decode the request body.
-	var req commentMessageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
-		return
-	}
-	if req.Reaction == "" {
-		http.Error(w, "Reaction cannot be empty", http.StatusBadRequest)
+	if req.TargetConversationID == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
 
-	// Insert the reaction.
-	err = rt.db.CommentMessage(messageID, userID, req.Reaction)
+	newMessageID, err := rt.db.ForwardMessage(originalMessageID, req.TargetConversationID, userID)
 	if err != nil {
-		http.Error(w, "Failed to add comment: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to forward message: "+err.Error(), statusForDBError(err))
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Comment added successfully"}); err != nil {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"messageId": newMessageID}); err != nil {
 		log.Printf("Error encoding response: %v", err)
 	}
 }
 
-func (rt *_router) uncommentMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
-	// Get authenticated user ID.
-	userID, err := rt.getAuthenticatedUserID(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+// forwardMessageToMany handles a batch forward. The response lists the outcome for each target in request order,
+// conversations first.
+func (rt *_router) forwardMessageToMany(w http.ResponseWriter, originalMessageID, userID string, req forwardMessageRequest) {
+	conversationIDs := req.TargetConversationIDs
+	if req.TargetConversationID != "" {
+		conversationIDs = append([]string{req.TargetConversationID}, conversationIDs...)
 	}
-
-	messageID := ps.ByName("messageId")
-	if messageID == "" {
-		http.Error(w, "Message ID is required", http.StatusBadRequest)
+	if len(conversationIDs)+len(req.TargetUserIDs) > maxForwardTargets {
+		http.Error(w, "Too many forward targets", http.StatusBadRequest)
 		return
 	}
 
-	err = rt.db.UncommentMessage(messageID, userID)
+	results, err := rt.db.ForwardMessageToMany(originalMessageID, userID, conversationIDs, req.TargetUserIDs)
 	if err != nil {
-		http.Error(w, "Failed to remove comment: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to forward message: "+err.Error(), statusForDBError(err))
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Comment removed successfully"}); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string][]database.ForwardResult{"results": results}); err != nil {
 		log.Printf("Error encoding response: %v", err)
 	}
 }
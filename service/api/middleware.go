@@ -8,7 +8,7 @@ import (
 // ErrUnauthorized is returned when the authorization header is missing or invalid.
 var ErrUnauthorized = errors.New("unauthorized")
 
-// getAuthenticatedUserID extracts the user ID from the Authorization header.
+// getAuthenticatedUserID extracts the user ID from the Authorization header, and records the user as active.
 // It expects the header to be in the format "Bearer <userID>".
 func (rt *_router) getAuthenticatedUserID(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
@@ -21,5 +21,6 @@ func (rt *_router) getAuthenticatedUserID(r *http.Request) (string, error) {
 	if userID == "" {
 		return "", ErrUnauthorized
 	}
+	rt.touchLastSeen(userID)
 	return userID, nil
 }
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// pinnedMessagesResponse defines the JSON response for listing pinned messages.
+type pinnedMessagesResponse struct {
+	Messages []database.Message `json:"messages"`
+}
+
+// pinMessage handles POST /conversations/:conversationId/pins/:messageId.
+func (rt *_router) pinMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	messageID := ps.ByName("messageId")
+	if conversationID == "" || messageID == "" {
+		http.Error(w, "Conversation ID and message ID are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.PinMessage(conversationID, messageID, userID); err != nil {
+		http.Error(w, "Failed to pin message: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Message pinned successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// unpinMessage handles DELETE /conversations/:conversationId/pins/:messageId.
+func (rt *_router) unpinMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	messageID := ps.ByName("messageId")
+	if conversationID == "" || messageID == "" {
+		http.Error(w, "Conversation ID and message ID are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.UnpinMessage(conversationID, messageID, userID); err != nil {
+		http.Error(w, "Failed to unpin message: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Message unpinned successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// listPinnedMessages handles GET /conversations/:conversationId/pins.
+func (rt *_router) listPinnedMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	if conversationID == "" {
+		http.Error(w, "Conversation ID is required", http.StatusBadRequest)
+		return
+	}
+
+	messages, err := rt.db.GetPinnedMessages(conversationID, userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve pinned messages: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(pinnedMessagesResponse{Messages: messages}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
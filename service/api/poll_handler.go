@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/donnim1/WASAText/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Limits on the size of polls.
+const (
+	maxPollQuestionLength = 300
+	maxPollOptionLength   = 100
+	minPollOptions        = 2
+	maxPollOptions        = 10
+)
+
+// pollRequest defines the poll part of a MessageRequest.
+type pollRequest struct {
+	Question       string   `json:"question"`
+	Options        []string `json:"options"`
+	MultipleChoice bool     `json:"multipleChoice"`
+	Anonymous      bool     `json:"anonymous"`
+	ClosesAt       string   `json:"closesAt,omitempty"` // Optional RFC3339 close time
+}
+
+// votePollRequest defines the payload for voting on a poll.
+type votePollRequest struct {
+	Options []int `json:"options"` // Indexes of the chosen options; empty to retract the vote
+}
+
+// toDatabase validates the poll and converts it for the database. It returns a message describing the problem if
+// the poll is invalid.
+func (p pollRequest) toDatabase() (database.PollRequest, string) {
+	question := strings.TrimSpace(p.Question)
+	if question == "" || len(question) > maxPollQuestionLength {
+		return database.PollRequest{}, "Poll question must be 1-300 characters"
+	}
+	if len(p.Options) < minPollOptions || len(p.Options) > maxPollOptions {
+		return database.PollRequest{}, "Poll must have 2-10 options"
+	}
+	options := make([]string, len(p.Options))
+	seen := make(map[string]bool, len(p.Options))
+	for i, option := range p.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len(option) > maxPollOptionLength {
+			return database.PollRequest{}, "Poll options must be 1-100 characters"
+		}
+		if seen[option] {
+			return database.PollRequest{}, "Poll options must be unique"
+		}
+		seen[option] = true
+		options[i] = option
+	}
+
+	poll := database.PollRequest{
+		Question:       question,
+		Options:        options,
+		MultipleChoice: p.MultipleChoice,
+		Anonymous:      p.Anonymous,
+	}
+	if p.ClosesAt != "" {
+		closesAt, err := time.Parse(time.RFC3339, p.ClosesAt)
+		if err != nil || !closesAt.After(globaltime.Now()) {
+			return database.PollRequest{}, "closesAt must be an RFC3339 timestamp in the future"
+		}
+		poll.ClosesAt = closesAt
+	}
+	return poll, ""
+}
+
+// sendPoll sends a MessageRequest carrying a poll. It is called by sendMessage once the request has been validated.
+func (rt *_router) sendPoll(w http.ResponseWriter, userID string, req MessageRequest) {
+	poll, problem := req.Poll.toDatabase()
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	messageID, conversationID, err := rt.db.SendPoll(userID, req.ReceiverID, req.IsGroup, req.GroupID, req.ConversationID, poll)
+	if err != nil {
+		http.Error(w, "Failed to send poll: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(MessageResponse{
+		MessageID:      messageID,
+		ConversationID: conversationID,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// votePoll handles POST /messages/:messageId/votes.
+func (rt *_router) votePoll(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req votePollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.VotePoll(messageID, userID, req.Options); err != nil {
+		http.Error(w, "Failed to vote: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Vote recorded successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
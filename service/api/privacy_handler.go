@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// getPrivacySettings handles GET /user/privacy.
+func (rt *_router) getPrivacySettings(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := rt.db.GetPrivacySettings(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve privacy settings: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// updatePrivacySettings handles PUT /user/privacy. Settings left out of the request keep their value.
+func (rt *_router) updatePrivacySettings(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req database.PrivacySettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := rt.db.UpdatePrivacySettings(userID, req)
+	if err != nil {
+		http.Error(w, "Failed to update privacy settings: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
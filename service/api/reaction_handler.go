@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// reactionsResponse defines the JSON response for listing who reacted to a message.
+type reactionsResponse struct {
+	Reactions []database.Reaction `json:"reactions"`
+}
+
+// reactionRequest defines the payload for reacting to a message.
+type reactionRequest struct {
+	Reaction string `json:"reaction"`
+}
+
+// addReaction handles POST /messages/:messageId/reactions.
+func (rt *_router) addReaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// Get authenticated user ID.
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Decode the request body.
+	var req reactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.Reaction == "" {
+		http.Error(w, "Reaction cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	// Insert the reaction.
+	err = rt.db.AddReaction(messageID, userID, req.Reaction)
+	if err != nil {
+		http.Error(w, "Failed to add reaction: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Reaction added successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// removeReactions handles DELETE /messages/:messageId/uncomment, removing all of the user's reactions.
+func (rt *_router) removeReactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	// Get authenticated user ID.
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	err = rt.db.RemoveReactions(messageID, userID)
+	if err != nil {
+		http.Error(w, "Failed to remove reactions: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Reactions removed successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// removeReaction handles DELETE /messages/:messageId/reactions/:emoji.
+func (rt *_router) removeReaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	emoji := ps.ByName("emoji")
+	if messageID == "" || emoji == "" {
+		http.Error(w, "Message ID and emoji are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.RemoveReaction(messageID, userID, emoji); err != nil {
+		http.Error(w, "Failed to remove reaction: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Reaction removed successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// listReactions handles GET /messages/:messageId/reactions, optionally filtered by the emoji query parameter.
+func (rt *_router) listReactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	reactions, err := rt.db.GetMessageReactions(messageID, userID, r.URL.Query().Get("emoji"))
+	if err != nil {
+		http.Error(w, "Failed to retrieve reactions: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(reactionsResponse{Reactions: reactions}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
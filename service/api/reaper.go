@@ -0,0 +1,36 @@
+package api
+
+import (
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+const (
+	// reapInterval is how often expired messages are deleted.
+	reapInterval = time.Minute
+
+	// reapBatch is the number of messages deleted per transaction, so that the reaper never holds the database for
+	// long.
+	reapBatch = 200
+)
+
+// reapExpiredMessages deletes every message whose disappearing-messages expiry has passed, in batches.
+func (rt *_router) reapExpiredMessages() {
+	now := globaltime.Now()
+	total := 0
+	for {
+		deleted, err := rt.db.DeleteExpiredMessages(now, reapBatch)
+		if err != nil {
+			rt.baseLogger.WithError(err).Error("can't delete expired messages")
+			return
+		}
+		total += deleted
+		if deleted < reapBatch {
+			break
+		}
+	}
+	if total > 0 {
+		rt.baseLogger.WithField("count", total).Debug("expired messages deleted")
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// messageRequestsResponse defines the JSON response for listing message requests.
+type messageRequestsResponse struct {
+	Requests []database.MessageRequest `json:"requests"`
+}
+
+// listMessageRequests handles GET /requests.
+func (rt *_router) listMessageRequests(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	requests, err := rt.db.GetMessageRequests(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve message requests: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(messageRequestsResponse{Requests: requests}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// acceptMessageRequest handles POST /requests/:conversationId/accept.
+func (rt *_router) acceptMessageRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := rt.db.AcceptMessageRequest(ps.ByName("conversationId"), userID); err != nil {
+		http.Error(w, "Failed to accept message request: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// declineMessageRequest handles POST /requests/:conversationId/decline.
+func (rt *_router) declineMessageRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := rt.db.DeclineMessageRequest(ps.ByName("conversationId"), userID); err != nil {
+		http.Error(w, "Failed to decline message request: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
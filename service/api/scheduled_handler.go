@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/donnim1/WASAText/service/globaltime"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxScheduleAhead is how far in the future a message may be scheduled.
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// scheduledMessagesResponse defines the JSON response for listing scheduled messages.
+type scheduledMessagesResponse struct {
+	ScheduledMessages []database.ScheduledMessage `json:"scheduledMessages"`
+}
+
+// rescheduleRequest defines the payload for changing the send time of a scheduled message.
+type rescheduleRequest struct {
+	SendAt string `json:"sendAt"`
+}
+
+// parseSendAt parses an RFC3339 send time and checks that it lies in the future, within maxScheduleAhead.
+func parseSendAt(value string) (time.Time, string) {
+	sendAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, "sendAt must be an RFC3339 timestamp"
+	}
+	now := globaltime.Now()
+	if !sendAt.After(now) {
+		return time.Time{}, "sendAt must be in the future"
+	}
+	if sendAt.Sub(now) > maxScheduleAhead {
+		return time.Time{}, "sendAt is too far in the future"
+	}
+	return sendAt, ""
+}
+
+// scheduleMessage stores a MessageRequest carrying a sendAt for later dispatch. It is called by sendMessage once
+// the request has been validated.
+func (rt *_router) scheduleMessage(w http.ResponseWriter, userID string, req MessageRequest) {
+	sendAt, problem := parseSendAt(req.SendAt)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	content := req.messageContent()
+	scheduledID, err := rt.db.ScheduleMessage(database.ScheduledMessage{
+		SenderID:       userID,
+		ReceiverID:     req.ReceiverID,
+		ConversationID: req.ConversationID,
+		GroupID:        req.GroupID,
+		IsGroup:        req.IsGroup,
+		Type:           content.Type,
+		Content:        content.Body,
+		Payload:        content.Payload,
+		Entities:       content.Entities,
+		AttachmentID:   content.AttachmentID,
+		ReplyTo:        req.ReplyTo,
+		SendAt:         sendAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		http.Error(w, "Failed to schedule message: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"scheduledMessageId": scheduledID,
+		"sendAt":             sendAt.UTC().Format(time.RFC3339),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// listScheduledMessages handles GET /scheduled and returns the authenticated user's scheduled messages.
+func (rt *_router) listScheduledMessages(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scheduled, err := rt.db.GetScheduledMessages(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve scheduled messages: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(scheduledMessagesResponse{ScheduledMessages: scheduled}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// cancelScheduledMessage handles DELETE /scheduled/:scheduledId.
+func (rt *_router) cancelScheduledMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scheduledID := ps.ByName("scheduledId")
+	if scheduledID == "" {
+		http.Error(w, "Scheduled message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.CancelScheduledMessage(scheduledID, userID); err != nil {
+		http.Error(w, "Failed to cancel scheduled message: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Scheduled message cancelled successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// rescheduleMessage handles PUT /scheduled/:scheduledId.
+func (rt *_router) rescheduleMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	scheduledID := ps.ByName("scheduledId")
+	if scheduledID == "" {
+		http.Error(w, "Scheduled message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req rescheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	sendAt, problem := parseSendAt(req.SendAt)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.RescheduleMessage(scheduledID, userID, sendAt); err != nil {
+		http.Error(w, "Failed to reschedule message: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Message rescheduled successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+const (
+	// scheduledDispatchInterval is how often the dispatcher looks for due scheduled messages.
+	scheduledDispatchInterval = 5 * time.Second
+
+	// scheduledDispatchBatch is the maximum number of messages sent in a single dispatcher run.
+	scheduledDispatchBatch = 100
+)
+
+// dispatchScheduledMessages sends every scheduled message that is due according to globaltime.Now(). Each message is
+// claimed first so that a concurrent cancellation either wins completely or not at all.
+func (rt *_router) dispatchScheduledMessages() {
+	due, err := rt.db.GetDueScheduledMessages(globaltime.Now(), scheduledDispatchBatch)
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("can't load due scheduled messages")
+		return
+	}
+
+	for _, sm := range due {
+		claimed, err := rt.db.ClaimScheduledMessage(sm.ID)
+		if err != nil {
+			rt.baseLogger.WithError(err).WithField("scheduled-id", sm.ID).Error("can't claim scheduled message")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		var failure string
+		messageID, _, err := rt.db.SendMessage(sm.SenderID, sm.ReceiverID, sm.MessageContent(), sm.IsGroup, sm.GroupID, sm.ConversationID, sm.ReplyTo)
+		if err != nil {
+			rt.baseLogger.WithError(err).WithField("scheduled-id", sm.ID).Warning("scheduled message dispatch failed")
+			failure = err.Error()
+		} else {
+			rt.baseLogger.WithField("scheduled-id", sm.ID).WithField("message-id", messageID).Debug("scheduled message sent")
+		}
+
+		if err := rt.db.FinishScheduledMessage(sm.ID, failure); err != nil {
+			rt.baseLogger.WithError(err).WithField("scheduled-id", sm.ID).Error("can't finish scheduled message")
+		}
+	}
+}
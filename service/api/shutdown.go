@@ -2,5 +2,9 @@ package api
 
 // Close should close everything opened in the lifecycle of the `_router`; for example, background goroutines.
 func (rt *_router) Close() error {
+	rt.cancel()
+	for _, task := range rt.tasks {
+		task.Stop()
+	}
 	return nil
 }
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// starredMessagesResponse defines the JSON response for listing starred messages.
+type starredMessagesResponse struct {
+	Messages []database.StarredMessage `json:"messages"`
+}
+
+// starMessage handles POST /messages/:messageId/star.
+func (rt *_router) starMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.StarMessage(messageID, userID); err != nil {
+		http.Error(w, "Failed to star message: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Message starred successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// unstarMessage handles DELETE /messages/:messageId/star.
+func (rt *_router) unstarMessage(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID := ps.ByName("messageId")
+	if messageID == "" {
+		http.Error(w, "Message ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.UnstarMessage(messageID, userID); err != nil {
+		http.Error(w, "Failed to unstar message: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Message unstarred successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// listStarredMessages handles GET /starred and returns the authenticated user's starred messages.
+func (rt *_router) listStarredMessages(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messages, err := rt.db.GetStarredMessages(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve starred messages: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(starredMessagesResponse{Messages: messages}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxStickerSize is the maximum size of a sticker image.
+const maxStickerSize = 512 << 10
+
+// stickerExtensions maps the accepted sticker image types to the extension they are stored with.
+var stickerExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// Search results are limited to defaultStickerSearchLimit stickers, or to the limit query parameter up to
+// maxStickerSearchLimit.
+const (
+	defaultStickerSearchLimit = 50
+	maxStickerSearchLimit     = 200
+)
+
+// createStickerPackRequest defines the payload for creating a sticker pack.
+type createStickerPackRequest struct {
+	Name string `json:"name"`
+}
+
+// shareStickerPackRequest defines the payload for sharing a sticker pack to a conversation.
+type shareStickerPackRequest struct {
+	PackID string `json:"packId"`
+}
+
+// stickerPacksResponse defines the JSON response for listing sticker packs.
+type stickerPacksResponse struct {
+	Packs []database.StickerPack `json:"packs"`
+}
+
+// stickersResponse defines the JSON response for searching stickers.
+type stickersResponse struct {
+	Stickers []database.Sticker `json:"stickers"`
+}
+
+// createStickerPack handles POST /sticker-packs.
+func (rt *_router) createStickerPack(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req createStickerPackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	pack, err := rt.db.CreateStickerPack(userID, req.Name)
+	if err != nil {
+		http.Error(w, "Failed to create sticker pack: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(pack); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// getStickerPack handles GET /sticker-packs/:packId.
+func (rt *_router) getStickerPack(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pack, err := rt.db.GetStickerPack(ps.ByName("packId"), userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve sticker pack: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(pack); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// addSticker handles POST /sticker-packs/:packId/stickers. The "sticker" form file must be a PNG or WebP image; the
+// "emojis" form field, which may be repeated, lists the emoji it is tagged with, separated by commas.
+func (rt *_router) addSticker(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	packID := ps.ByName("packId")
+
+	// Leave room for the multipart framing and the emoji field.
+	r.Body = http.MaxBytesReader(w, r.Body, maxStickerSize+64<<10)
+	file, _, err := r.FormFile("sticker")
+	if err != nil {
+		http.Error(w, "A sticker image is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxStickerSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read sticker image", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxStickerSize {
+		http.Error(w, "Sticker image too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	mimeType := http.DetectContentType(data)
+	ext, ok := stickerExtensions[mimeType]
+	if !ok {
+		http.Error(w, "Stickers must be PNG or WebP images", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var emojis []string
+	for _, v := range r.MultipartForm.Value["emojis"] {
+		emojis = append(emojis, strings.Split(v, ",")...)
+	}
+
+	stickerID, err := database.GenerateNewID()
+	if err != nil {
+		http.Error(w, "Failed to store sticker", http.StatusInternalServerError)
+		return
+	}
+	name := "stickers/" + stickerID + ext
+	if _, err := rt.storage.Put(name, bytes.NewReader(data)); err != nil {
+		ctx.Logger.WithError(err).Error("can't store sticker")
+		http.Error(w, "Failed to store sticker", http.StatusInternalServerError)
+		return
+	}
+
+	sticker, err := rt.db.AddSticker(packID, userID, database.Sticker{
+		ID:       stickerID,
+		URL:      rt.storage.URL(name),
+		MimeType: mimeType,
+		Emojis:   emojis,
+	})
+	if err != nil {
+		if rmErr := rt.storage.Delete(name); rmErr != nil {
+			ctx.Logger.WithError(rmErr).Warning("can't remove file of rejected sticker")
+		}
+		http.Error(w, "Failed to add sticker: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(sticker); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// deleteSticker handles DELETE /sticker-packs/:packId/stickers/:stickerId. The file is left to the media collector,
+// since sent sticker messages still show it.
+func (rt *_router) deleteSticker(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := rt.db.DeleteSticker(ps.ByName("packId"), ps.ByName("stickerId"), userID); err != nil {
+		http.Error(w, "Failed to delete sticker: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listInstalledStickerPacks handles GET /user/sticker-packs.
+func (rt *_router) listInstalledStickerPacks(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	packs, err := rt.db.GetInstalledStickerPacks(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve sticker packs: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stickerPacksResponse{Packs: packs}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// installStickerPack handles PUT /user/sticker-packs/:packId.
+func (rt *_router) installStickerPack(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := rt.db.InstallStickerPack(ps.ByName("packId"), userID); err != nil {
+		http.Error(w, "Failed to install sticker pack: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uninstallStickerPack handles DELETE /user/sticker-packs/:packId.
+func (rt *_router) uninstallStickerPack(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := rt.db.UninstallStickerPack(ps.ByName("packId"), userID); err != nil {
+		http.Error(w, "Failed to uninstall sticker pack: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// shareStickerPack handles POST /conversations/:conversationId/sticker-packs.
+func (rt *_router) shareStickerPack(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req shareStickerPackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PackID == "" {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.ShareStickerPack(req.PackID, ps.ByName("conversationId"), userID); err != nil {
+		http.Error(w, "Failed to share sticker pack: "+err.Error(), statusForDBError(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listSharedStickerPacks handles GET /conversations/:conversationId/sticker-packs.
+func (rt *_router) listSharedStickerPacks(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	packs, err := rt.db.GetSharedStickerPacks(ps.ByName("conversationId"), userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve sticker packs: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stickerPacksResponse{Packs: packs}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// searchStickers handles GET /stickers/search?emoji=, over the packs the user installed.
+func (rt *_router) searchStickers(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	emoji := strings.TrimSpace(r.URL.Query().Get("emoji"))
+	if emoji == "" {
+		http.Error(w, "An emoji is required", http.StatusBadRequest)
+		return
+	}
+	limit := defaultStickerSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxStickerSearchLimit {
+			http.Error(w, "Limit must be between 1 and "+strconv.Itoa(maxStickerSearchLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	stickers, err := rt.db.SearchStickers(userID, emoji, limit)
+	if err != nil {
+		http.Error(w, "Failed to search stickers: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(stickersResponse{Stickers: stickers}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
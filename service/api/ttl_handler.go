@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/julienschmidt/httprouter"
+)
+
+// messageTTLOptions maps the disappearing-messages settings accepted by the API to a TTL in seconds.
+var messageTTLOptions = map[string]int{
+	"off": 0,
+	"1h":  60 * 60,
+	"24h": 24 * 60 * 60,
+	"7d":  7 * 24 * 60 * 60,
+}
+
+// setMessageTTLRequest defines the payload for changing the disappearing-messages setting.
+type setMessageTTLRequest struct {
+	TTL string `json:"ttl"` // One of "off", "1h", "24h", "7d"
+}
+
+// setMessageTTL handles PUT /conversations/:conversationId/ttl.
+func (rt *_router) setMessageTTL(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID := ps.ByName("conversationId")
+	if conversationID == "" {
+		http.Error(w, "Conversation ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req setMessageTTLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	ttl, ok := messageTTLOptions[req.TTL]
+	if !ok {
+		http.Error(w, "ttl must be one of off, 1h, 24h, 7d", http.StatusBadRequest)
+		return
+	}
+
+	if err := rt.db.SetConversationTTL(conversationID, userID, ttl); err != nil {
+		http.Error(w, "Failed to update disappearing messages: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": "Disappearing messages updated successfully"}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
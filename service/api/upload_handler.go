@@ -0,0 +1,318 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/audio"
+	"github.com/donnim1/WASAText/service/database"
+	"github.com/julienschmidt/httprouter"
+)
+
+// chunkContentType is the content type of the chunks sent with PATCH /media/uploads/:uploadId.
+const chunkContentType = "application/offset+octet-stream"
+
+// CreateUploadRequest defines the payload for starting a chunked upload.
+type CreateUploadRequest struct {
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType,omitempty"`
+	Size     int64  `json:"size"`
+}
+
+// setUploadHeaders reports the progress of an upload, in the headers of every upload response.
+func setUploadHeaders(w http.ResponseWriter, u database.Upload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Received, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// createUpload handles POST /media/uploads. The file is then sent in chunks with PATCH on the upload's Location and
+// turned into an attachment with POST on its /finalize.
+func (rt *_router) createUpload(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.Size > maxUploadSize {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	upload, err := rt.db.CreateUpload(database.Upload{
+		UserID:   userID,
+		Filename: req.Filename,
+		MimeType: req.MimeType,
+		Size:     req.Size,
+	})
+	if err != nil {
+		http.Error(w, "Failed to create upload: "+err.Error(), statusForDBError(err))
+		return
+	}
+	if err := os.MkdirAll(partialUploadsDir, 0o700); err == nil {
+		err = os.WriteFile(partialUploadPath(upload.ID), nil, 0o600)
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't create upload file")
+		if err := rt.db.DeleteUpload(upload.ID, userID); err != nil {
+			ctx.Logger.WithError(err).Warning("can't delete failed upload")
+		}
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	setUploadHeaders(w, upload)
+	w.Header().Set("Location", "/media/uploads/"+upload.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(upload); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// getUploadStatus handles HEAD /media/uploads/:uploadId: Upload-Offset tells where to resume.
+func (rt *_router) getUploadStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, _ reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	upload, err := rt.db.GetUpload(ps.ByName("uploadId"), userID)
+	if err != nil {
+		w.WriteHeader(statusForDBError(err))
+		return
+	}
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadChunk handles PATCH /media/uploads/:uploadId. The chunk must start at the Upload-Offset of the upload; a
+// chunk cut short is discarded whole and can be sent again.
+func (rt *_router) uploadChunk(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, chunkContentType) {
+		http.Error(w, "Content-Type must be "+chunkContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "A valid Upload-Offset header is required", http.StatusBadRequest)
+		return
+	}
+
+	// The chunk is read in full before anything is written, so that an interrupted request leaves the upload as it was.
+	chunk, err := io.ReadAll(io.LimitReader(r.Body, maxChunkSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read chunk", http.StatusBadRequest)
+		return
+	}
+	if len(chunk) > maxChunkSize {
+		http.Error(w, "Chunk larger than "+strconv.Itoa(maxChunkSize)+" bytes", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	uploadID := ps.ByName("uploadId")
+	unlock := rt.uploads.lock(uploadID)
+	defer unlock()
+
+	upload, err := rt.db.GetUpload(uploadID, userID)
+	if err != nil {
+		http.Error(w, "Failed to upload chunk: "+err.Error(), statusForDBError(err))
+		return
+	}
+	setUploadHeaders(w, upload)
+	if offset != upload.Received {
+		http.Error(w, "Upload-Offset does not match the bytes received", http.StatusConflict)
+		return
+	}
+	end := offset + int64(len(chunk))
+	if end > upload.Size {
+		http.Error(w, "Chunk goes past the end of the file", http.StatusBadRequest)
+		return
+	}
+
+	f, err := os.OpenFile(partialUploadPath(uploadID), os.O_WRONLY, 0)
+	if err == nil {
+		_, err = f.WriteAt(chunk, offset)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't write upload chunk")
+		http.Error(w, "Failed to upload chunk", http.StatusInternalServerError)
+		return
+	}
+	if err := rt.db.AdvanceUpload(uploadID, offset, end); err != nil {
+		http.Error(w, "Failed to upload chunk: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	upload.Received = end
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finalizeUpload handles POST /media/uploads/:uploadId/finalize. The complete file is moved to storage and recorded
+// as an attachment, whose id can be sent as attachmentId in a message. Ogg/Opus and WAV files become audio
+// attachments with their measured duration and waveform, pictures image attachments, and the rest plain files.
+func (rt *_router) finalizeUpload(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uploadID := ps.ByName("uploadId")
+	unlock := rt.uploads.lock(uploadID)
+	defer unlock()
+
+	upload, err := rt.db.GetUpload(uploadID, userID)
+	if err != nil {
+		http.Error(w, "Failed to finalize upload: "+err.Error(), statusForDBError(err))
+		return
+	}
+	setUploadHeaders(w, upload)
+	if upload.Received != upload.Size {
+		http.Error(w, "Upload incomplete", http.StatusConflict)
+		return
+	}
+
+	f, err := os.Open(partialUploadPath(uploadID))
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't open upload file")
+		http.Error(w, "Failed to finalize upload", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	attachment, ext, err := describeUpload(f, upload)
+	if err != nil {
+		ctx.Logger.WithError(err).Error("can't read upload file")
+		http.Error(w, "Failed to finalize upload", http.StatusInternalServerError)
+		return
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		ctx.Logger.WithError(err).Error("can't read upload file")
+		http.Error(w, "Failed to finalize upload", http.StatusInternalServerError)
+		return
+	}
+	name := attachment.Kind + "/" + upload.ID + ext
+	if _, err := rt.storage.Put(name, f); err != nil {
+		ctx.Logger.WithError(err).Error("can't store uploaded file")
+		http.Error(w, "Failed to finalize upload", http.StatusInternalServerError)
+		return
+	}
+	attachment.URL = rt.storage.URL(name)
+
+	attachment, err = rt.db.CompleteUpload(uploadID, attachment)
+	if err != nil {
+		if rmErr := rt.storage.Delete(name); rmErr != nil {
+			ctx.Logger.WithError(rmErr).Warning("can't remove file of failed upload")
+		}
+		http.Error(w, "Failed to finalize upload: "+err.Error(), statusForDBError(err))
+		return
+	}
+	if err := removePartialUpload(uploadID); err != nil {
+		ctx.Logger.WithError(err).Warning("can't remove finalized upload file")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(attachment); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// deleteUpload handles DELETE /media/uploads/:uploadId, abandoning an upload and the bytes received so far.
+func (rt *_router) deleteUpload(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uploadID := ps.ByName("uploadId")
+	unlock := rt.uploads.lock(uploadID)
+	defer unlock()
+
+	if err := rt.db.DeleteUpload(uploadID, userID); err != nil {
+		http.Error(w, "Failed to delete upload: "+err.Error(), statusForDBError(err))
+		return
+	}
+	if err := removePartialUpload(uploadID); err != nil {
+		ctx.Logger.WithError(err).Warning("can't remove deleted upload file")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// describeUpload returns the attachment an upload becomes, without its URL, and the extension to store it under.
+// The type is sniffed from the content; the one declared by the client only names plain files.
+func describeUpload(f *os.File, upload database.Upload) (database.Attachment, string, error) {
+	a := database.Attachment{
+		ID:         upload.ID,
+		UploaderID: upload.UserID,
+		Kind:       database.AttachmentKindFile,
+		Name:       upload.Filename,
+		MimeType:   upload.MimeType,
+		Size:       upload.Size,
+	}
+
+	if upload.Size <= maxAudioUploadSize {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return database.Attachment{}, "", err
+		}
+		info, err := audio.Probe(data)
+		if err == nil && info.Duration <= database.MaxAudioDuration {
+			a.Kind = database.AttachmentKindAudio
+			a.MimeType = info.MimeType
+			a.DurationMs = info.Duration.Milliseconds()
+			a.Waveform = info.Waveform
+			return a, info.Extension, nil
+		}
+	}
+
+	head := make([]byte, 512)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return database.Attachment{}, "", err
+	}
+	sniffed := http.DetectContentType(head[:n])
+	if ext, ok := imageExtensions[sniffed]; ok {
+		a.Kind = database.AttachmentKindImage
+		a.MimeType = sniffed
+		return a, ext, nil
+	}
+	if a.MimeType == "" {
+		a.MimeType = sniffed
+	}
+	return a, storedExtension(upload.Filename), nil
+}
+
+// imageExtensions maps the image types sent as image messages to the extension they are stored under.
+var imageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+const (
+	// partialUploadsDir holds the uploads still being received. Unlike uploadsDir it is not served.
+	partialUploadsDir = "uploads-partial"
+
+	// maxUploadSize is the largest file that can be uploaded in chunks.
+	maxUploadSize = 1 << 30
+
+	// maxChunkSize is the largest chunk accepted by PATCH /media/uploads/:uploadId. A chunk must arrive within the
+	// server's read timeout, so clients on slow links should send smaller ones.
+	maxChunkSize = 8 << 20
+
+	// staleUploadAge is how long an upload may go without receiving a chunk before it is deleted.
+	staleUploadAge = 24 * time.Hour
+
+	// staleUploadSweepInterval is how often stale uploads are deleted.
+	staleUploadSweepInterval = time.Hour
+)
+
+// keyedMutex provides one mutex per key, held only while in use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the mutex of key and returns the function unlocking it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	l := k.locks[key]
+	if l == nil {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// partialUploadPath returns the file holding the bytes received so far for an upload.
+func partialUploadPath(uploadID string) string {
+	return filepath.Join(partialUploadsDir, uploadID)
+}
+
+// removePartialUpload deletes the received bytes of an upload, if any.
+func removePartialUpload(uploadID string) error {
+	if err := os.Remove(partialUploadPath(uploadID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// activeExtensions are the file extensions browsers would run or render as documents; uploads with these keep their
+// name but are stored as .bin.
+var activeExtensions = map[string]bool{
+	".htm": true, ".html": true, ".xhtml": true, ".xht": true, ".shtml": true, ".svg": true, ".svgz": true,
+	".xml": true, ".xsl": true, ".js": true, ".mjs": true, ".swf": true,
+}
+
+// storedExtension returns the extension under which an uploaded file is stored: its own if harmless, else ".bin".
+func storedExtension(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if len(ext) < 2 || len(ext) > 10 || activeExtensions[ext] {
+		return ".bin"
+	}
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return ".bin"
+		}
+	}
+	return ext
+}
+
+// deleteStaleUploads deletes the uploads that stopped receiving chunks, with their received bytes.
+func (rt *_router) deleteStaleUploads() {
+	ids, err := rt.db.DeleteStaleUploads(globaltime.Now().Add(-staleUploadAge))
+	if err != nil {
+		rt.baseLogger.WithError(err).Error("can't delete stale uploads")
+		return
+	}
+	for _, id := range ids {
+		if err := removePartialUpload(id); err != nil {
+			rt.baseLogger.WithError(err).WithField("upload", id).Warning("can't remove stale upload")
+		}
+	}
+	if len(ids) > 0 {
+		rt.baseLogger.WithField("count", len(ids)).Debug("stale uploads deleted")
+	}
+}
@@ -2,13 +2,11 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/database"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -24,6 +22,12 @@ type userNameUpdateResponse struct {
 	Message string `json:"message"`
 }
 
+// Bounds of the length of usernames, in bytes.
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 16
+)
+
 // setMyUserName updates the username for an existing user.
 func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
 	// Validate the Authorization header and extract the authenticated user ID.
@@ -41,8 +45,8 @@ func (rt *_router) setMyUserName(w http.ResponseWriter, r *http.Request, _ httpr
 	}
 
 	// Validate the new username length.
-	if len(req.NewName) < 3 || len(req.NewName) > 16 {
-		http.Error(w, "Username must be 3-16 characters", http.StatusBadRequest)
+	if len(req.NewName) < minUsernameLength || len(req.NewName) > maxUsernameLength {
+		http.Error(w, "Username must be "+strconv.Itoa(minUsernameLength)+"-"+strconv.Itoa(maxUsernameLength)+" characters", http.StatusBadRequest)
 		return
 	}
 
@@ -84,33 +88,13 @@ func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, _ httprout
 	if fileErr == nil { // File upload is happening.
 		defer file.Close() // Ensure the file is closed properly.
 
-		// Ensure upload directory exists.
-		uploadDir := "uploads/"
-		if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-			log.Printf("❌ Failed to create upload directory: %v", err)
-			http.Error(w, "Server error: cannot create directory", http.StatusInternalServerError)
-			return
-		}
-
-		// Save file to uploads directory.
-		filePath := filepath.Join(uploadDir, header.Filename)
-		out, err := os.Create(filePath)
+		// Store the photo under a new name, so that the previous one is left for the media collector.
+		photoUrl, err := rt.storePhoto(file, header.Filename)
 		if err != nil {
-			log.Printf("❌ Failed to create file: %v", err)
+			log.Printf("❌ Failed to store photo: %v", err)
 			http.Error(w, "Failed to save file", http.StatusInternalServerError)
 			return
 		}
-		defer out.Close()
-
-		// Copy file contents.
-		if _, err := io.Copy(out, file); err != nil {
-			log.Printf("❌ Failed to write file: %v", err)
-			http.Error(w, "Failed to write file", http.StatusInternalServerError)
-			return
-		}
-
-		// Convert file path to forward-slashed URL.
-		photoUrl := fmt.Sprintf("/%s", filepath.ToSlash(filePath))
 		if err := rt.db.UpdateUserPhoto(userID, photoUrl); err != nil {
 			log.Printf("❌ Database update failed: %v", err)
 			http.Error(w, "Failed to update photo in database", http.StatusInternalServerError)
@@ -157,35 +141,55 @@ func (rt *_router) setMyPhoto(w http.ResponseWriter, r *http.Request, _ httprout
 	http.Error(w, "Invalid request", http.StatusBadRequest)
 }
 
+// Pages of the user list hold defaultUserListLimit users, or the limit query parameter up to maxUserListLimit.
+const (
+	defaultUserListLimit = 50
+	maxUserListLimit     = 200
+)
+
 // listUsersResponse defines the JSON response for listing users.
 type listUsersResponse struct {
-	Users []UserSummary `json:"users"`
+	Users      []UserSummary `json:"users"`
+	NextCursor string        `json:"nextCursor,omitempty"`
 }
 
 // UserSummary represents a simplified user object.
-type UserSummary struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	PhotoUrl string `json:"photoUrl"`
-}
+type UserSummary = database.UserSummary
 
-// listUsers handles GET requests to /users and returns all users.
+// listUsers handles GET requests to /users?q=&limit=&cursor= and returns a page of the users whose username matches
+// q, except the caller and those they blocked. The response carries the cursor of the next page, if any.
 func (rt *_router) listUsers(w http.ResponseWriter, r *http.Request, _ httprouter.Params, ctx reqcontext.RequestContext) {
-	// (Optional) Validate Authorization header if you want only authenticated users to view the list.
-	if _, err := rt.getAuthenticatedUserID(r); err != nil {
+	userID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	limit := defaultUserListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxUserListLimit {
+			http.Error(w, "Limit must be between 1 and "+strconv.Itoa(maxUserListLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// No username matches a longer search, so it is not worth a scan of the users.
+	query := r.URL.Query().Get("q")
+	if len(query) > maxUsernameLength {
+		http.Error(w, "Search must be at most "+strconv.Itoa(maxUsernameLength)+" characters", http.StatusBadRequest)
+		return
+	}
+
 	// Call the database function to list users.
-	users, err := rt.db.ListUsers()
+	users, next, err := rt.db.ListUsers(userID, query, limit, r.URL.Query().Get("cursor"))
 	if err != nil {
-		http.Error(w, "Failed to list users: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to list users: "+err.Error(), statusForDBError(err))
 		return
 	}
 
 	// Build a response slice with just the summary info.
-	var summaries []UserSummary
+	summaries := []UserSummary{}
 	for _, u := range users {
 		photo := ""
 		if u.PhotoUrl.Valid {
@@ -195,13 +199,14 @@ func (rt *_router) listUsers(w http.ResponseWriter, r *http.Request, _ httproute
 			ID:       u.ID,
 			Username: u.Username,
 			PhotoUrl: photo,
+			LastSeen: u.LastSeen.String,
 		})
 		// If iterating through rows (if using sql.Rows), ensure after the loop to call rows.Err()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(listUsersResponse{Users: summaries}); err != nil {
+	if err := json.NewEncoder(w).Encode(listUsersResponse{Users: summaries, NextCursor: next}); err != nil {
 		log.Printf("Error encoding response: %v", err)
 	}
 }
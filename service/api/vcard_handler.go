@@ -0,0 +1,85 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/donnim1/WASAText/service/api/reqcontext"
+	"github.com/donnim1/WASAText/service/vcard"
+	"github.com/julienschmidt/httprouter"
+)
+
+// exportUserVCard handles GET /users/:userId/vcard and returns the user's contact card. The version query parameter
+// selects vCard "3.0" or "4.0" (the default).
+func (rt *_router) exportUserVCard(w http.ResponseWriter, r *http.Request, ps httprouter.Params, ctx reqcontext.RequestContext) {
+	viewerID, err := rt.getAuthenticatedUserID(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID := ps.ByName("userId")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		version = "4.0"
+	}
+	if version != "3.0" && version != "4.0" {
+		http.Error(w, "version must be 3.0 or 4.0", http.StatusBadRequest)
+		return
+	}
+
+	user, err := rt.db.GetUserSummary(viewerID, userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user: "+err.Error(), statusForDBError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+vcardFileName(user.Username)+`"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(userVCard(user, version).String())); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// userVCard builds the contact card of a user.
+func userVCard(user UserSummary, version string) *vcard.Card {
+	card := vcard.New(version)
+	if version == "4.0" {
+		card.AddRaw("KIND", "individual", nil)
+	}
+	card.Add("FN", user.Username)
+	card.Add("NICKNAME", user.Username)
+	if version == "3.0" {
+		// N is required in vCard 3.0; usernames have no family name.
+		card.AddRaw("N", vcard.Escape(user.Username)+";;;;", nil)
+	}
+	card.AddRaw("UID", "urn:uuid:"+user.ID, nil)
+	if strings.HasPrefix(user.PhotoUrl, "https://") || strings.HasPrefix(user.PhotoUrl, "http://") {
+		if version == "3.0" {
+			card.AddRaw("PHOTO", user.PhotoUrl, map[string][]string{"VALUE": {"uri"}})
+		} else {
+			card.AddRaw("PHOTO", user.PhotoUrl, nil)
+		}
+	}
+	return card
+}
+
+// vcardFileName returns a safe file name for a user's card.
+func vcardFileName(username string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return -1
+	}, username)
+	if name == "" || strings.Trim(name, ".") == "" {
+		name = "contact"
+	}
+	return name + ".vcf"
+}
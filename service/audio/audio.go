@@ -0,0 +1,55 @@
+/*
+Package audio reads the headers of uploaded voice messages. It recognizes Ogg/Opus and WAV files, reports their
+duration and, for uncompressed WAV audio, computes a coarse amplitude waveform that clients draw as a scrubber.
+
+Nothing is decoded beyond what the container tells: Opus audio has no waveform.
+*/
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WaveformBars is the number of values in Info.Waveform.
+const WaveformBars = 64
+
+var (
+	// ErrUnsupported is returned for data that is neither Ogg/Opus nor WAV.
+	ErrUnsupported = errors.New("unsupported audio format")
+	// ErrCorrupt is returned when the container is recognized but malformed or truncated.
+	ErrCorrupt = errors.New("corrupt audio file")
+)
+
+// Info describes an audio file.
+type Info struct {
+	MimeType   string
+	Extension  string // File name extension, with the dot
+	Duration   time.Duration
+	SampleRate int
+	Channels   int
+	// Waveform holds WaveformBars peak amplitudes from 0 to 100, or nil if the audio is compressed.
+	Waveform []int
+}
+
+// Probe identifies an audio file from its content. Files that hold no audio are corrupt.
+func Probe(data []byte) (Info, error) {
+	var info Info
+	var err error
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		info, err = probeWAV(data)
+	case len(data) >= 4 && string(data[0:4]) == "OggS":
+		info, err = probeOgg(data)
+	default:
+		return Info{}, ErrUnsupported
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	if info.Duration <= 0 {
+		return Info{}, fmt.Errorf("%w: no audio", ErrCorrupt)
+	}
+	return info, nil
+}
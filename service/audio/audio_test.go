@@ -0,0 +1,148 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v)), uint32(v>>32))
+}
+
+// wavFile returns a 16-bit PCM WAV file holding samples, all on one channel.
+func wavFile(sampleRate int, samples []int16) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(s))
+	}
+	f := []byte("RIFF\x00\x00\x00\x00WAVE")
+	f = append(f, "fmt "...)
+	f = appendUint32(f, 16)
+	f = appendUint16(f, wavFormatPCM)
+	f = appendUint16(f, 1)
+	f = appendUint32(f, uint32(sampleRate))
+	f = appendUint32(f, uint32(2*sampleRate))
+	f = appendUint16(f, 2)
+	f = appendUint16(f, 16)
+	f = append(f, "data"...)
+	f = appendUint32(f, uint32(len(data)))
+	f = append(f, data...)
+	binary.LittleEndian.PutUint32(f[4:], uint32(len(f)-8))
+	return f
+}
+
+// oggPageBytes returns an Ogg page of stream 1 with the given header type, granule position and body, which must be
+// shorter than 255 bytes. The checksum is not filled in; probeOgg does not check it.
+func oggPageBytes(headerType byte, granule int64, body []byte) []byte {
+	p := []byte{'O', 'g', 'g', 'S', 0, headerType}
+	p = appendUint64(p, uint64(granule))
+	p = appendUint32(p, 1)
+	p = appendUint32(p, 0)
+	p = appendUint32(p, 0)
+	p = append(p, 1, byte(len(body)))
+	return append(p, body...)
+}
+
+// opusHead returns an OpusHead packet for a stereo stream with the given pre-skip.
+func opusHead(preSkip uint16) []byte {
+	h := []byte("OpusHead")
+	h = append(h, 1, 2)
+	h = appendUint16(h, preSkip)
+	h = appendUint32(h, 44100)
+	return append(h, 0, 0, 0)
+}
+
+// oggFile returns an Ogg/Opus file whose last page ends at granule.
+func oggFile(preSkip uint16, granule int64) []byte {
+	f := oggPageBytes(0x02, 0, opusHead(preSkip))
+	f = append(f, oggPageBytes(0, 0, []byte("OpusTags"))...)
+	f = append(f, oggPageBytes(0, -1, []byte{1, 2, 3})...)
+	return append(f, oggPageBytes(0x04, granule, []byte{4, 5, 6})...)
+}
+
+func TestProbe(t *testing.T) {
+	loud := make([]int16, 8000)
+	for i := range loud {
+		loud[i] = math.MaxInt16
+	}
+	wav := wavFile(8000, loud)
+	ogg := oggFile(312, 312+48000*3/2)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		err      error
+		duration time.Duration
+		mimeType string
+	}{
+		{name: "wav", data: wav, duration: time.Second, mimeType: "audio/wav"},
+		{name: "wav without samples", data: wavFile(8000, nil), err: ErrCorrupt},
+		{name: "wav with truncated fmt chunk", data: wav[:30], err: ErrCorrupt},
+		{name: "wav with truncated data chunk", data: wav[:44+8000], duration: 500 * time.Millisecond, mimeType: "audio/wav"},
+		{name: "ogg", data: ogg, duration: 1500 * time.Millisecond, mimeType: "audio/ogg"},
+		{name: "truncated ogg", data: ogg[:len(ogg)-2], err: ErrCorrupt},
+		{name: "ogg without audio", data: oggFile(312, 312), err: ErrCorrupt},
+		{name: "ogg granule before pre-skip", data: oggFile(312, 100), err: ErrCorrupt},
+		{name: "ogg with huge granule", data: oggFile(0, math.MaxInt64), err: ErrCorrupt},
+		{name: "ogg granule just past the duration range", data: oggFile(0, maxOggSamples+1), err: ErrCorrupt},
+		{name: "ogg with negative granule", data: oggFile(0, -2), err: ErrCorrupt},
+		{name: "ogg of another codec", data: oggPageBytes(0x02, 0, []byte("\x01vorbis\x00\x00\x00\x00\x02")), err: ErrUnsupported},
+		{name: "mp3", data: []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), err: ErrUnsupported},
+		{name: "empty", data: nil, err: ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(tt.data)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Probe() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if info.Duration != tt.duration || info.MimeType != tt.mimeType {
+				t.Errorf("Probe() = %v %s, want %v %s", info.Duration, info.MimeType, tt.duration, tt.mimeType)
+			}
+		})
+	}
+}
+
+func TestProbeOggDurationFitsRange(t *testing.T) {
+	info, err := Probe(oggFile(0, maxOggSamples))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if info.Duration <= 0 {
+		t.Errorf("Probe() duration = %v, want positive", info.Duration)
+	}
+}
+
+func TestWAVWaveform(t *testing.T) {
+	samples := make([]int16, 6400)
+	for i := 3200; i < len(samples); i++ {
+		samples[i] = math.MinInt16
+	}
+	info, err := Probe(wavFile(8000, samples))
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if len(info.Waveform) != WaveformBars {
+		t.Fatalf("len(Waveform) = %d, want %d", len(info.Waveform), WaveformBars)
+	}
+	if info.Waveform[0] != 0 || info.Waveform[WaveformBars-1] != 100 {
+		t.Errorf("Waveform = %v, want silence then full scale", info.Waveform)
+	}
+}
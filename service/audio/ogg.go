@@ -0,0 +1,106 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// opusRate is the rate of Opus granule positions, whatever the input sample rate.
+const opusRate = 48000
+
+// maxOggSamples is the largest sample count whose duration fits a time.Duration.
+const maxOggSamples = math.MaxInt64 / int64(time.Second)
+
+// oggPage is the part of an Ogg page header needed to find the stream duration.
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	body       []byte
+	next       int // Offset of the following page
+}
+
+// readOggPage reads the page starting at pos.
+func readOggPage(data []byte, pos int) (oggPage, error) {
+	if pos+27 > len(data) || string(data[pos:pos+4]) != "OggS" || data[pos+4] != 0 {
+		return oggPage{}, fmt.Errorf("%w: bad Ogg page at offset %d", ErrCorrupt, pos)
+	}
+	segments := int(data[pos+26])
+	bodyStart := pos + 27 + segments
+	if bodyStart > len(data) {
+		return oggPage{}, fmt.Errorf("%w: truncated Ogg page at offset %d", ErrCorrupt, pos)
+	}
+	size := 0
+	for _, s := range data[pos+27 : bodyStart] {
+		size += int(s)
+	}
+	if bodyStart+size > len(data) {
+		return oggPage{}, fmt.Errorf("%w: truncated Ogg page at offset %d", ErrCorrupt, pos)
+	}
+	return oggPage{
+		headerType: data[pos+5],
+		granule:    int64(binary.LittleEndian.Uint64(data[pos+6 : pos+14])),
+		serial:     binary.LittleEndian.Uint32(data[pos+14 : pos+18]),
+		body:       data[bodyStart : bodyStart+size],
+		next:       bodyStart + size,
+	}, nil
+}
+
+// probeOgg reads an Ogg/Opus file. The first page carries the OpusHead header; the granule position of the last
+// page of the stream, less the pre-skip, is its length in 48 kHz samples.
+func probeOgg(data []byte) (Info, error) {
+	first, err := readOggPage(data, 0)
+	if err != nil {
+		return Info{}, err
+	}
+	const bos = 0x02
+	if first.headerType&bos == 0 {
+		return Info{}, fmt.Errorf("%w: first Ogg page does not begin a stream", ErrCorrupt)
+	}
+	head := first.body
+	if len(head) < 19 || string(head[0:8]) != "OpusHead" {
+		return Info{}, fmt.Errorf("%w: Ogg stream is not Opus", ErrUnsupported)
+	}
+	if head[8]>>4 != 0 {
+		return Info{}, fmt.Errorf("%w: Opus header version %d", ErrUnsupported, head[8])
+	}
+	channels := int(head[9])
+	preSkip := int64(binary.LittleEndian.Uint16(head[10:12]))
+	inputRate := int(binary.LittleEndian.Uint32(head[12:16]))
+	if channels == 0 {
+		return Info{}, fmt.Errorf("%w: Opus stream without channels", ErrCorrupt)
+	}
+
+	granule := int64(-1)
+	for pos := first.next; pos < len(data); {
+		page, err := readOggPage(data, pos)
+		if err != nil {
+			return Info{}, err
+		}
+		// Pages that complete no packet carry a granule position of -1.
+		if page.serial == first.serial && page.granule != -1 {
+			granule = page.granule
+		}
+		pos = page.next
+	}
+	if granule <= preSkip {
+		return Info{}, fmt.Errorf("%w: Opus stream without audio", ErrCorrupt)
+	}
+	// Bound the sample count so that converting it to a time.Duration cannot overflow.
+	if granule-preSkip > maxOggSamples {
+		return Info{}, fmt.Errorf("%w: Opus granule position %d out of range", ErrCorrupt, granule)
+	}
+	if inputRate == 0 {
+		inputRate = opusRate
+	}
+
+	return Info{
+		MimeType:   "audio/ogg",
+		Extension:  ".ogg",
+		Duration:   time.Duration(granule-preSkip) * time.Second / opusRate,
+		SampleRate: inputRate,
+		Channels:   channels,
+	}, nil
+}
@@ -0,0 +1,146 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// WAV format codes of the fmt chunk.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// wavFormat is the content of the fmt chunk.
+type wavFormat struct {
+	code          uint16
+	channels      int
+	sampleRate    int
+	blockAlign    int
+	bitsPerSample int
+}
+
+// probeWAV reads a RIFF/WAVE file: the fmt chunk gives the sample layout and the data chunk the samples.
+func probeWAV(data []byte) (Info, error) {
+	var format *wavFormat
+	var samples []byte
+
+	pos := 12
+	for pos+8 <= len(data) && samples == nil {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size > len(body) {
+			if id != "data" {
+				return Info{}, fmt.Errorf("%w: truncated %q chunk", ErrCorrupt, id)
+			}
+			// Recorders that stream WAV may leave the data size unset; take what is there.
+			size = len(body)
+		}
+		body = body[:size]
+
+		switch id {
+		case "fmt ":
+			f, err := parseWAVFormat(body)
+			if err != nil {
+				return Info{}, err
+			}
+			format = &f
+		case "data":
+			if format == nil {
+				return Info{}, fmt.Errorf("%w: data chunk before fmt chunk", ErrCorrupt)
+			}
+			samples = body
+		}
+		// Chunks are padded to an even size.
+		pos += 8 + size + size%2
+	}
+	if format == nil || samples == nil {
+		return Info{}, fmt.Errorf("%w: missing fmt or data chunk", ErrCorrupt)
+	}
+
+	frames := len(samples) / format.blockAlign
+	info := Info{
+		MimeType:   "audio/wav",
+		Extension:  ".wav",
+		Duration:   time.Duration(frames) * time.Second / time.Duration(format.sampleRate),
+		SampleRate: format.sampleRate,
+		Channels:   format.channels,
+		Waveform:   wavWaveform(*format, samples[:frames*format.blockAlign]),
+	}
+	return info, nil
+}
+
+func parseWAVFormat(body []byte) (wavFormat, error) {
+	if len(body) < 16 {
+		return wavFormat{}, fmt.Errorf("%w: short fmt chunk", ErrCorrupt)
+	}
+	f := wavFormat{
+		code:          binary.LittleEndian.Uint16(body[0:2]),
+		channels:      int(binary.LittleEndian.Uint16(body[2:4])),
+		sampleRate:    int(binary.LittleEndian.Uint32(body[4:8])),
+		blockAlign:    int(binary.LittleEndian.Uint16(body[12:14])),
+		bitsPerSample: int(binary.LittleEndian.Uint16(body[14:16])),
+	}
+	if f.code == wavFormatExtensible {
+		// The actual format is the first two bytes of the sub-format GUID.
+		if len(body) < 26 {
+			return wavFormat{}, fmt.Errorf("%w: short extensible fmt chunk", ErrCorrupt)
+		}
+		f.code = binary.LittleEndian.Uint16(body[24:26])
+	}
+
+	switch {
+	case f.code == wavFormatPCM && (f.bitsPerSample == 8 || f.bitsPerSample == 16 || f.bitsPerSample == 24 || f.bitsPerSample == 32):
+	case f.code == wavFormatFloat && f.bitsPerSample == 32:
+	default:
+		return wavFormat{}, fmt.Errorf("%w: WAV encoding %d with %d bits", ErrUnsupported, f.code, f.bitsPerSample)
+	}
+	if f.channels < 1 || f.sampleRate < 1 || f.blockAlign != f.channels*f.bitsPerSample/8 {
+		return wavFormat{}, fmt.Errorf("%w: inconsistent fmt chunk", ErrCorrupt)
+	}
+	return f, nil
+}
+
+// wavWaveform splits the samples in WaveformBars spans and returns the peak amplitude of each, scaled to 0-100.
+// Only the first channel is read.
+func wavWaveform(f wavFormat, samples []byte) []int {
+	frames := len(samples) / f.blockAlign
+	bars := make([]int, WaveformBars)
+	if frames == 0 {
+		return bars
+	}
+	width := f.bitsPerSample / 8
+	for bar := range bars {
+		start, end := frames*bar/WaveformBars, frames*(bar+1)/WaveformBars
+		peak := 0.0
+		for i := start; i < end; i++ {
+			if v := math.Abs(wavSample(f, samples[i*f.blockAlign:i*f.blockAlign+width])); v > peak {
+				peak = v
+			}
+		}
+		bars[bar] = int(math.Round(math.Min(peak, 1) * 100))
+	}
+	return bars
+}
+
+// wavSample decodes one sample to the range [-1, 1].
+func wavSample(f wavFormat, b []byte) float64 {
+	switch {
+	case f.code == wavFormatFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case f.bitsPerSample == 8:
+		// 8-bit WAV is unsigned.
+		return (float64(b[0]) - 128) / 128
+	case f.bitsPerSample == 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case f.bitsPerSample == 24:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
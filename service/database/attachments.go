@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// MaxAudioDuration is the maximum length of an audio message.
+const MaxAudioDuration = 10 * time.Minute
+
+// maxWaveformBars is the maximum number of values in the waveform of an audio message.
+const maxWaveformBars = 128
+
+// Kinds of attachments.
+const (
+	AttachmentKindAudio = "audio"
+)
+
+// Attachment is a file uploaded to be sent in a message, with the metadata the server extracted from it.
+type Attachment struct {
+	ID         string `json:"id"`
+	UploaderID string `json:"uploaderId"`
+	Kind       string `json:"kind"`
+	URL        string `json:"url"`
+	Name       string `json:"name,omitempty"`
+	MimeType   string `json:"mimeType"`
+	Size       int64  `json:"size"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	Waveform   []int  `json:"waveform,omitempty"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// CreateAttachment records an uploaded file. The caller chooses the ID, which names the stored file.
+func (db *appdbimpl) CreateAttachment(a Attachment) (Attachment, error) {
+	return insertAttachment(db.db, a)
+}
+
+// insertAttachment checks the metadata of an attachment and inserts it.
+func insertAttachment(q dbtx, a Attachment) (Attachment, error) {
+	if a.Kind == AttachmentKindAudio {
+		if a.DurationMs < 0 || a.DurationMs > MaxAudioDuration.Milliseconds() {
+			return Attachment{}, fmt.Errorf("%w: audio must be at most %v long", ErrInvalidContent, MaxAudioDuration)
+		}
+		if len(a.Waveform) > maxWaveformBars {
+			return Attachment{}, fmt.Errorf("%w: waveform longer than %d bars", ErrInvalidContent, maxWaveformBars)
+		}
+	}
+
+	var waveform interface{}
+	if a.Waveform != nil {
+		b, err := json.Marshal(a.Waveform)
+		if err != nil {
+			return Attachment{}, fmt.Errorf("failed to encode waveform: %w", err)
+		}
+		waveform = string(b)
+	}
+	a.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err := q.Exec(`INSERT INTO attachments (id, uploader_id, kind, url, name, mime_type, size, duration_ms, waveform, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.UploaderID, a.Kind, a.URL, a.Name, a.MimeType, a.Size, a.DurationMs, waveform, a.CreatedAt)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to create attachment: %w", err)
+	}
+	return a, nil
+}
+
+// applyAttachmentMetadata replaces the metadata of an audio message with what the server measured for its uploaded
+// file, so that clients cannot misreport the duration or waveform. Audio messages must point to an uploaded audio
+// file. content must have been normalized.
+func applyAttachmentMetadata(q dbtx, content *MessageContent) error {
+	if content.Type != MessageTypeAudio {
+		return nil
+	}
+	var p AudioPayload
+	if err := json.Unmarshal(content.Payload, &p); err != nil {
+		return fmt.Errorf("failed to decode audio payload: %w", err)
+	}
+
+	var waveform sql.NullString
+	err := q.QueryRow("SELECT mime_type, duration_ms, waveform FROM attachments WHERE url = ? AND kind = ?",
+		p.URL, AttachmentKindAudio).Scan(&p.MimeType, &p.DurationMs, &waveform)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: audio must be an uploaded audio file", ErrInvalidContent)
+	} else if err != nil {
+		return fmt.Errorf("failed to look up attachment: %w", err)
+	}
+	p.Waveform = nil
+	if waveform.Valid {
+		if err := json.Unmarshal([]byte(waveform.String), &p.Waveform); err != nil {
+			log.Printf("failed to decode waveform of %s: %v", p.URL, err)
+		}
+	}
+	return content.encodePayload(p)
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrBlocked is returned when a private chat is between users one of whom blocked the other.
+	ErrBlocked = errors.New("user is blocked")
+	// ErrInvalidBlock is returned when a user tries to block themselves.
+	ErrInvalidBlock = errors.New("invalid block")
+)
+
+// BlockedUser is a user on someone's blocklist.
+type BlockedUser struct {
+	UserSummary
+	BlockedAt string `json:"blockedAt"`
+}
+
+// BlockUser adds blockedID to the blocklist of blockerID. Neither can then message the other in a private chat; their
+// groups are not affected. Blocking a user again does nothing.
+func (db *appdbimpl) BlockUser(blockerID, blockedID string) error {
+	if blockerID == blockedID {
+		return fmt.Errorf("%w: users cannot block themselves", ErrInvalidBlock)
+	}
+	var exists bool
+	if err := db.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)", blockedID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	_, err := db.db.Exec(`INSERT INTO user_blocks (blocker_id, blocked_id, blocked_at) VALUES (?, ?, ?)
+		ON CONFLICT (blocker_id, blocked_id) DO NOTHING`,
+		blockerID, blockedID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	return nil
+}
+
+// UnblockUser removes blockedID from the blocklist of blockerID. Unblocking a user who is not blocked is a no-op.
+func (db *appdbimpl) UnblockUser(blockerID, blockedID string) error {
+	if _, err := db.db.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID); err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	return nil
+}
+
+// GetBlockedUsers returns the blocklist of a user, most recently blocked first.
+func (db *appdbimpl) GetBlockedUsers(blockerID string) ([]BlockedUser, error) {
+	rows, err := db.db.Query(`SELECT u.id, u.username, `+visiblePhoto+`, b.blocked_at
+		FROM user_blocks b JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY b.blocked_at DESC, u.username`, blockerID, blockerID, blockerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []BlockedUser{}
+	for rows.Next() {
+		var u BlockedUser
+		var photo sql.NullString
+		if err := rows.Scan(&u.ID, &u.Username, &photo, &u.BlockedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan blocked user: %w", err)
+		}
+		u.PhotoUrl = photo.String
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return users, nil
+}
+
+// checkBlocked returns ErrBlocked if either user blocked the other.
+func checkBlocked(q dbtx, userID, otherID string) error {
+	var blocked bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM user_blocks
+		WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))`,
+		userID, otherID, otherID, userID).Scan(&blocked)
+	if err != nil {
+		return fmt.Errorf("failed to check blocklist: %w", err)
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// checkConversationBlocked returns ErrBlocked if conversationID is a private chat between userID and someone either
+// of them blocked. Groups are never blocked.
+func checkConversationBlocked(q dbtx, conversationID, userID string) error {
+	var blocked bool
+	err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM group_members gm
+		JOIN conversations c ON c.id = gm.group_id AND c.is_group = 0
+		JOIN user_blocks b ON (b.blocker_id = ? AND b.blocked_id = gm.user_id) OR (b.blocker_id = gm.user_id AND b.blocked_id = ?)
+		WHERE gm.group_id = ? AND gm.user_id != ?)`,
+		userID, userID, conversationID, userID).Scan(&blocked)
+	if err != nil {
+		return fmt.Errorf("failed to check blocklist: %w", err)
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxCommentLength is the maximum length of a comment in bytes.
+const maxCommentLength = 500
+
+// ErrInvalidComment is returned for comments that are empty or too long.
+var ErrInvalidComment = errors.New("invalid comment")
+
+// ErrCommentNotFound is returned when a comment does not exist on the message or was written by another user.
+var ErrCommentNotFound = errors.New("comment not found")
+
+// Comment is a short text annotation attached to a message by a member of its conversation.
+type Comment struct {
+	ID        string `json:"id"`
+	MessageID string `json:"messageId"`
+	UserID    string `json:"userId"`
+	UserName  string `json:"userName"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"createdAt"`
+	EditedAt  string `json:"editedAt,omitempty"`
+}
+
+// normalizeComment trims a comment and checks its length.
+func normalizeComment(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" || len(content) > maxCommentLength {
+		return "", ErrInvalidComment
+	}
+	return content, nil
+}
+
+// AddComment attaches a comment to a message. The user must be a member of the message's conversation.
+func (db *appdbimpl) AddComment(messageID, userID, content string) (Comment, error) {
+	content, err := normalizeComment(content)
+	if err != nil {
+		return Comment{}, err
+	}
+	conversationID, err := db.messageConversationID(messageID)
+	if err != nil {
+		return Comment{}, err
+	}
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return Comment{}, err
+	}
+
+	commentID, err := GenerateNewID()
+	if err != nil {
+		return Comment{}, fmt.Errorf("GenerateNewID error: %w", err)
+	}
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	_, err = db.db.Exec(
+		"INSERT INTO message_comments (id, message_id, user_id, content, created_at) VALUES (?, ?, ?, ?, ?)",
+		commentID, messageID, userID, content, currentTime)
+	if err != nil {
+		return Comment{}, fmt.Errorf("failed to add comment: %w", err)
+	}
+	return db.getComment(commentID)
+}
+
+// EditComment replaces the text of one of the user's comments on a message.
+func (db *appdbimpl) EditComment(messageID, commentID, userID, content string) (Comment, error) {
+	content, err := normalizeComment(content)
+	if err != nil {
+		return Comment{}, err
+	}
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	res, err := db.db.Exec(
+		"UPDATE message_comments SET content = ?, edited_at = ? WHERE id = ? AND message_id = ? AND user_id = ?",
+		content, currentTime, commentID, messageID, userID)
+	if err != nil {
+		return Comment{}, fmt.Errorf("failed to edit comment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return Comment{}, fmt.Errorf("failed to edit comment: %w", err)
+	}
+	if affected == 0 {
+		return Comment{}, ErrCommentNotFound
+	}
+	return db.getComment(commentID)
+}
+
+// DeleteComment deletes one of the user's comments on a message.
+func (db *appdbimpl) DeleteComment(messageID, commentID, userID string) error {
+	res, err := db.db.Exec("DELETE FROM message_comments WHERE id = ? AND message_id = ? AND user_id = ?",
+		commentID, messageID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+	if affected == 0 {
+		return ErrCommentNotFound
+	}
+	return nil
+}
+
+const commentColumns = `mc.id, mc.message_id, mc.user_id, u.username, mc.content, mc.created_at, mc.edited_at`
+
+// scanComment scans a row selecting commentColumns.
+func scanComment(scan func(dest ...interface{}) error) (Comment, error) {
+	var c Comment
+	var userName, editedAt sql.NullString
+	if err := scan(&c.ID, &c.MessageID, &c.UserID, &userName, &c.Content, &c.CreatedAt, &editedAt); err != nil {
+		return c, err
+	}
+	c.UserName = userName.String
+	c.EditedAt = editedAt.String
+	return c, nil
+}
+
+// getComment returns a single comment.
+func (db *appdbimpl) getComment(commentID string) (Comment, error) {
+	row := db.db.QueryRow("SELECT "+commentColumns+
+		" FROM message_comments mc LEFT JOIN users u ON u.id = mc.user_id WHERE mc.id = ?", commentID)
+	c, err := scanComment(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, ErrCommentNotFound
+	} else if err != nil {
+		return c, fmt.Errorf("failed to read comment: %w", err)
+	}
+	return c, nil
+}
+
+// attachComments sets the comments of each message, oldest first.
+func (db *appdbimpl) attachComments(messages []Message) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messages)), ",")
+	args := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		args = append(args, msg.ID)
+	}
+
+	rows, err := db.db.Query("SELECT "+commentColumns+
+		" FROM message_comments mc LEFT JOIN users u ON u.id = mc.user_id"+
+		" WHERE mc.message_id IN ("+placeholders+") ORDER BY mc.created_at ASC", args...)
+	if err != nil {
+		return fmt.Errorf("failed to query comments: %w", err)
+	}
+	defer rows.Close()
+
+	comments := make(map[string][]Comment)
+	for rows.Next() {
+		c, err := scanComment(rows.Scan)
+		if err != nil {
+			return fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments[c.MessageID] = append(comments[c.MessageID], c)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("comment rows iteration error: %w", err)
+	}
+
+	for i := range messages {
+		if c, ok := comments[messages[i].ID]; ok {
+			messages[i].Comments = c
+		} else {
+			messages[i].Comments = []Comment{}
+		}
+	}
+	return nil
+}
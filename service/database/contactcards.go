@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GetUserSummary returns the public profile of a user as viewerID sees it; the photo follows the user's privacy
+// settings.
+func (db *appdbimpl) GetUserSummary(viewerID, userID string) (UserSummary, error) {
+	u := UserSummary{ID: userID}
+	var photo sql.NullString
+	err := db.db.QueryRow("SELECT u.username, "+visiblePhoto+" FROM users u WHERE u.id = ?",
+		viewerID, viewerID, userID).Scan(&u.Username, &photo)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserSummary{}, ErrUserNotFound
+	} else if err != nil {
+		return UserSummary{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	u.PhotoUrl = photo.String
+	return u, nil
+}
+
+// contactUserID returns the user a normalized contact message refers to, or "".
+func contactUserID(content MessageContent) string {
+	if content.Type != MessageTypeContact {
+		return ""
+	}
+	var p ContactPayload
+	if err := json.Unmarshal(content.Payload, &p); err != nil {
+		return ""
+	}
+	return p.UserID
+}
+
+// checkContactUser returns ErrUserNotFound if a contact message refers to a user that does not exist.
+func checkContactUser(q dbtx, content MessageContent) error {
+	userID := contactUserID(content)
+	if userID == "" {
+		return nil
+	}
+	var count int
+	if err := q.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", userID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to look up contact: %w", err)
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// attachContactUsers sets the current profile of the users that contact messages refer to, as viewerID sees it, so
+// that a renamed user shows up under their new name.
+func (db *appdbimpl) attachContactUsers(messages []Message, viewerID string) error {
+	byUser := make(map[string][]int)
+	for i, msg := range messages {
+		userID := contactUserID(MessageContent{Type: msg.Type, Payload: msg.Payload})
+		if userID != "" {
+			byUser[userID] = append(byUser[userID], i)
+		}
+	}
+	if len(byUser) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(byUser)+2)
+	args = append(args, viewerID, viewerID)
+	for userID := range byUser {
+		args = append(args, userID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(byUser)), ",")
+	rows, err := db.db.Query("SELECT u.id, u.username, "+visiblePhoto+" FROM users u WHERE u.id IN ("+placeholders+")", args...)
+	if err != nil {
+		return fmt.Errorf("failed to query contact users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u UserSummary
+		var photo sql.NullString
+		if err := rows.Scan(&u.ID, &u.Username, &photo); err != nil {
+			return fmt.Errorf("failed to scan contact user: %w", err)
+		}
+		u.PhotoUrl = photo.String
+		for _, i := range byUser[u.ID] {
+			user := u
+			messages[i].ContactUser = &user
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("contact user rows iteration error: %w", err)
+	}
+	return nil
+}
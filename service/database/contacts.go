@@ -0,0 +1,117 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxNicknameLength is the maximum length, in characters, of the nickname a user gives a contact.
+const maxNicknameLength = 64
+
+var (
+	// ErrContactNotFound is returned for users that are not on someone's contacts list.
+	ErrContactNotFound = errors.New("contact not found")
+	// ErrInvalidContact is returned when a user adds themselves as a contact or gives a contact a nickname that is
+	// too long.
+	ErrInvalidContact = errors.New("invalid contact")
+)
+
+// Contact is a user on someone's contacts list, with the nickname they gave them, if any. Nicknames are private to
+// the owner of the list.
+type Contact struct {
+	UserSummary
+	Nickname string `json:"nickname"`
+	Favorite bool   `json:"favorite"`
+	AddedAt  string `json:"addedAt"`
+}
+
+// SaveContact adds contactID to the contacts list of ownerID, or updates the nickname and favorite flag of a user
+// already on it. An empty nickname shows the contact under their username.
+func (db *appdbimpl) SaveContact(ownerID, contactID, nickname string, favorite bool) (Contact, error) {
+	nickname = strings.TrimSpace(nickname)
+	if ownerID == contactID {
+		return Contact{}, fmt.Errorf("%w: users cannot add themselves as a contact", ErrInvalidContact)
+	}
+	if utf8.RuneCountInString(nickname) > maxNicknameLength {
+		return Contact{}, fmt.Errorf("%w: nickname must be at most %d characters", ErrInvalidContact, maxNicknameLength)
+	}
+	var exists bool
+	if err := db.db.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)", contactID).Scan(&exists); err != nil {
+		return Contact{}, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !exists {
+		return Contact{}, ErrUserNotFound
+	}
+	_, err := db.db.Exec(`INSERT INTO contacts (owner_id, contact_id, nickname, favorite, added_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (owner_id, contact_id) DO UPDATE SET nickname = excluded.nickname, favorite = excluded.favorite`,
+		ownerID, contactID, nickname, favorite, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return Contact{}, fmt.Errorf("failed to save contact: %w", err)
+	}
+	contacts, err := db.queryContacts(ownerID, "AND ct.contact_id = ?", contactID)
+	if err != nil {
+		return Contact{}, err
+	}
+	if len(contacts) == 0 {
+		return Contact{}, ErrContactNotFound
+	}
+	return contacts[0], nil
+}
+
+// DeleteContact removes contactID from the contacts list of ownerID.
+func (db *appdbimpl) DeleteContact(ownerID, contactID string) error {
+	res, err := db.db.Exec("DELETE FROM contacts WHERE owner_id = ? AND contact_id = ?", ownerID, contactID)
+	if err != nil {
+		return fmt.Errorf("failed to delete contact: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete contact: %w", err)
+	}
+	if affected == 0 {
+		return ErrContactNotFound
+	}
+	return nil
+}
+
+// GetContacts returns the contacts list of a user, favorites first, then by the name the user sees.
+func (db *appdbimpl) GetContacts(ownerID string) ([]Contact, error) {
+	return db.queryContacts(ownerID, "")
+}
+
+// queryContacts returns the contacts of ownerID matching the extra condition where, which may refer to the contacts
+// row as ct. The photo and last seen time of each contact follow their privacy settings.
+func (db *appdbimpl) queryContacts(ownerID, where string, args ...interface{}) ([]Contact, error) {
+	query := `SELECT u.id, u.username,
+			` + visiblePhoto + `,
+			CASE WHEN ` + visibleTo("last_seen_visibility") + ` THEN u.last_seen_at END,
+			ct.nickname, ct.favorite, ct.added_at
+		FROM contacts ct JOIN users u ON u.id = ct.contact_id
+		WHERE ct.owner_id = ? ` + where + `
+		ORDER BY ct.favorite DESC, COALESCE(NULLIF(ct.nickname, ''), u.username) COLLATE NOCASE`
+	rows, err := db.db.Query(query, append([]interface{}{ownerID, ownerID, ownerID, ownerID, ownerID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contacts: %w", err)
+	}
+	defer rows.Close()
+
+	contacts := []Contact{}
+	for rows.Next() {
+		var c Contact
+		var photo, lastSeen sql.NullString
+		if err := rows.Scan(&c.ID, &c.Username, &photo, &lastSeen, &c.Nickname, &c.Favorite, &c.AddedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan contact: %w", err)
+		}
+		c.PhotoUrl = photo.String
+		c.LastSeen = lastSeen.String
+		contacts = append(contacts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return contacts, nil
+}
@@ -2,12 +2,14 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
+	"github.com/donnim1/WASAText/service/globaltime"
+	"github.com/donnim1/WASAText/service/markup"
 	"github.com/gofrs/uuid"
 )
 
@@ -18,23 +20,162 @@ type AppDatabase interface {
 	UpdateUserName(userID, newName string) error
 	UpdateUserPhoto(userID, photoUrl string) error
 
-	// ListUsers retrieves all users.
-	ListUsers() ([]User, error)
+	// ListUsers returns a page of the users whose username matches query, except viewerID and those they blocked,
+	// and the cursor of the next page.
+	ListUsers(viewerID, query string, limit int, cursor string) ([]User, string, error)
+	// GetUserSummary returns the public profile of a user as viewerID sees it, or ErrUserNotFound.
+	GetUserSummary(viewerID, userID string) (UserSummary, error)
 
 	// In the AppDatabase interface:
 	GetChatPartner(conversationID, currentUserID string) (*User, error)
 	GetConversationBetween(userID1, userID2 string) (*Conversation, error)
 	GetConversationsByUserID(userID string) ([]Conversation, error)
-	GetConversation(conversationID string) (*Conversation, []Message, error)
+	// GetConversation returns a conversation and its messages as seen by viewerID.
+	GetConversation(conversationID, viewerID string) (*Conversation, []Message, error)
 
-	SendMessage(senderID, receiverID, content string, isGroup bool, groupID, conversationID string, replyTo string) (string, string, error)
+	// SendMessage validates content with MessageContent.Normalize and stores it as a new message.
+	SendMessage(senderID, receiverID string, content MessageContent, isGroup bool, groupID, conversationID string, replyTo string) (string, string, error)
 	ForwardMessage(originalMessageID, targetConversationID, senderID string) (string, error)
-	CommentMessage(messageID, userID, reaction string) error
-	UncommentMessage(messageID, userID string) error
+	// ForwardMessageToMany forwards a message to several conversations and users in one transaction.
+	ForwardMessageToMany(originalMessageID, senderID string, conversationIDs, userIDs []string) ([]ForwardResult, error)
+	AddReaction(messageID, userID, reaction string) error
+	RemoveReactions(messageID, userID string) error
+	AddComment(messageID, userID, content string) (Comment, error)
+	EditComment(messageID, commentID, userID, content string) (Comment, error)
+	DeleteComment(messageID, commentID, userID string) error
+
+	// GetPendingLinkPreviews returns URLs found in messages whose preview has not been fetched yet.
+	GetPendingLinkPreviews(limit int) ([]string, error)
+	// SaveLinkPreview stores a fetched preview, or the reason fetching it failed.
+	SaveLinkPreview(preview LinkPreview, failure string) error
+	RemoveReaction(messageID, userID, reaction string) error
+	GetMessageReactions(messageID, userID, emoji string) ([]Reaction, error)
 	DeleteMessage(messageID, senderID string) error
 
 	UpdateMessageStatus(messageID, status, userID string) error
 
+	// PinMessage pins a message in its conversation. In groups only admins may pin.
+	PinMessage(conversationID, messageID, userID string) error
+	// UnpinMessage removes a pin. In groups only admins may unpin.
+	UnpinMessage(conversationID, messageID, userID string) error
+	// GetPinnedMessages returns the pinned messages of a conversation, most recently pinned first.
+	GetPinnedMessages(conversationID, userID string) ([]Message, error)
+
+	// StarMessage bookmarks a message for the user, who must be a member of its conversation.
+	StarMessage(messageID, userID string) error
+	UnstarMessage(messageID, userID string) error
+	// GetStarredMessages returns the user's starred messages, most recently starred first.
+	GetStarredMessages(userID string) ([]StarredMessage, error)
+
+	// ScheduleMessage stores a message to be sent at sm.SendAt and returns its ID.
+	ScheduleMessage(sm ScheduledMessage) (string, error)
+	GetScheduledMessages(userID string) ([]ScheduledMessage, error)
+	CancelScheduledMessage(scheduledID, userID string) error
+	RescheduleMessage(scheduledID, userID string, sendAt time.Time) error
+	// GetDueScheduledMessages returns up to limit pending messages whose send time is not after now.
+	GetDueScheduledMessages(now time.Time, limit int) ([]ScheduledMessage, error)
+	// ClaimScheduledMessage marks a pending message as being dispatched. It reports false if the message was
+	// cancelled or claimed in the meantime.
+	ClaimScheduledMessage(scheduledID string) (bool, error)
+	// FinishScheduledMessage removes a dispatched message, or marks it as failed if failure is not empty.
+	FinishScheduledMessage(scheduledID, failure string) error
+
+	// CreateAttachment records an uploaded file and the metadata extracted from it.
+	CreateAttachment(a Attachment) (Attachment, error)
+
+	// CreateUpload starts a chunked upload, within the limits on the uploads a user may have in progress.
+	CreateUpload(u Upload) (Upload, error)
+	// GetUpload returns one of the user's uploads.
+	GetUpload(uploadID, userID string) (Upload, error)
+	// AdvanceUpload moves an upload from offset from to offset to once a chunk is stored.
+	AdvanceUpload(uploadID string, from, to int64) error
+	// CompleteUpload replaces a fully received upload with an attachment.
+	CompleteUpload(uploadID string, a Attachment) (Attachment, error)
+	// DeleteUpload abandons one of the user's uploads.
+	DeleteUpload(uploadID, userID string) error
+	// DeleteStaleUploads deletes the uploads not touched since before and returns their IDs.
+	DeleteStaleUploads(before time.Time) ([]string, error)
+
+	// ReferencedMediaURLs returns the URLs of the stored files still in use.
+	ReferencedMediaURLs() (map[string]bool, error)
+	// ReleaseMedia removes the stored files at urls that are still unreferenced, and forgets their attachments.
+	ReleaseMedia(urls []string, remove func(url string) error) ([]string, error)
+
+	// ListInlineImages returns messages whose content is a base64 image, after the message at afterRowID.
+	ListInlineImages(afterRowID int64, limit int) ([]InlineImage, error)
+	// AttachmentURLExists reports whether an attachment is stored at url.
+	AttachmentURLExists(url string) (bool, error)
+	// ReplaceInlineImage rewrites a message with an inline image to refer to the stored attachment a.
+	ReplaceInlineImage(img InlineImage, a Attachment, width, height int) (bool, error)
+
+	// GetPrivacySettings returns who may see the user's photo, last seen time and read receipts.
+	GetPrivacySettings(userID string) (PrivacySettings, error)
+	// UpdatePrivacySettings changes the non-empty privacy settings of the user.
+	UpdatePrivacySettings(userID string, s PrivacySettings) (PrivacySettings, error)
+	// UpdateLastSeen records when the user was last active.
+	UpdateLastSeen(userID string, at time.Time) error
+
+	// GetMessageRequests returns the private chats started with the user against their privacy settings.
+	GetMessageRequests(userID string) ([]MessageRequest, error)
+	// AcceptMessageRequest moves a message request to the user's conversations.
+	AcceptMessageRequest(conversationID, userID string) error
+	// DeclineMessageRequest hides a message request for good.
+	DeclineMessageRequest(conversationID, userID string) error
+
+	// SaveContact adds a user to the contacts list of another, or updates their nickname and favorite flag.
+	SaveContact(ownerID, contactID, nickname string, favorite bool) (Contact, error)
+	// DeleteContact removes a user from the contacts list of another.
+	DeleteContact(ownerID, contactID string) error
+	// GetContacts returns the contacts list of a user, favorites first.
+	GetContacts(ownerID string) ([]Contact, error)
+
+	// BlockUser stops blockedID and blockerID from messaging each other in private chats.
+	BlockUser(blockerID, blockedID string) error
+	UnblockUser(blockerID, blockedID string) error
+	GetBlockedUsers(blockerID string) ([]BlockedUser, error)
+
+	// CreateStickerPack creates an empty sticker pack, installed for its owner.
+	CreateStickerPack(ownerID, name string) (StickerPack, error)
+	// GetStickerPack returns a pack the user owns, installed or was shared in one of their conversations.
+	GetStickerPack(packID, userID string) (StickerPack, error)
+	GetInstalledStickerPacks(userID string) ([]StickerPack, error)
+	// AddSticker adds a stored sticker to one of the user's packs.
+	AddSticker(packID, userID string, s Sticker) (Sticker, error)
+	DeleteSticker(packID, stickerID, userID string) error
+	InstallStickerPack(packID, userID string) error
+	UninstallStickerPack(packID, userID string) error
+	// ShareStickerPack offers a pack to the members of a conversation.
+	ShareStickerPack(packID, conversationID, userID string) error
+	GetSharedStickerPacks(conversationID, userID string) ([]StickerPack, error)
+	// SearchStickers finds the stickers tagged with emoji in the user's installed packs.
+	SearchStickers(userID, emoji string, limit int) ([]Sticker, error)
+
+	// UpdateLiveLocation moves an active live location; only its sender may.
+	UpdateLiveLocation(messageID, userID string, update LocationUpdate) (LiveLocation, error)
+	// StopLiveLocation ends a live location before its period is over.
+	StopLiveLocation(messageID, userID string) (LiveLocation, error)
+	GetLiveLocation(messageID, userID string) (LiveLocation, error)
+	// EndExpiredLiveLocations ends the live locations whose period is over and returns their message IDs.
+	EndExpiredLiveLocations(now time.Time) ([]string, error)
+
+	// SaveDraft replaces the user's draft in a conversation; an empty draft deletes it. The message handler deletes
+	// the sender's draft once a message typed in the conversation is sent.
+	SaveDraft(conversationID, userID string, draft Draft) (Draft, error)
+	GetDraft(conversationID, userID string) (Draft, error)
+	DeleteDraft(conversationID, userID string) error
+
+	// SetConversationTTL sets how many seconds new messages of the conversation are kept (0 disables expiry).
+	// Members of private chats and admins of groups may change it.
+	SetConversationTTL(conversationID, userID string, ttlSeconds int) error
+	// DeleteExpiredMessages deletes up to limit messages that expired before now, with the data attached to them,
+	// and returns how many were deleted.
+	DeleteExpiredMessages(now time.Time, limit int) (int, error)
+
+	// SendPoll sends a poll message; its content is the poll question. Conversation handling matches SendMessage.
+	SendPoll(senderID, receiverID string, isGroup bool, groupID, conversationID string, poll PollRequest) (string, string, error)
+	// VotePoll replaces the user's votes on a poll with the given option indexes. An empty list retracts the vote.
+	VotePoll(messageID, userID string, options []int) error
+
 	// CreateGroup creates a new group conversation and adds the creator as a member.
 	CreateGroup(creatorID, groupName, groupPhoto string) (string, error)
 	// Register the GET /groups endpoint.
@@ -48,6 +189,27 @@ type AppDatabase interface {
 	Ping() error
 }
 
+// Errors returned by AppDatabase methods that callers may want to distinguish.
+var (
+	// ErrNotMember is returned when the user does not belong to the conversation.
+	ErrNotMember = errors.New("user is not a member of the conversation")
+	// ErrNotAdmin is returned when a group operation requires admin rights.
+	ErrNotAdmin = errors.New("user is not an admin of the group")
+	// ErrMessageNotFound is returned when the message does not exist in the given conversation.
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrScheduledMessageNotFound is returned when a scheduled message does not exist, belongs to another user, or
+	// is already being dispatched.
+	ErrScheduledMessageNotFound = errors.New("scheduled message not found")
+	// ErrPollNotFound is returned when the message is not a poll.
+	ErrPollNotFound = errors.New("poll not found")
+	// ErrPollClosed is returned when voting on a poll whose close time has passed.
+	ErrPollClosed = errors.New("poll is closed")
+	// ErrInvalidVote is returned when the options voted for do not fit the poll.
+	ErrInvalidVote = errors.New("invalid vote")
+	// ErrUserNotFound is returned when a user ID does not exist.
+	ErrUserNotFound = errors.New("user not found")
+)
+
 // appdbimpl is the concrete implementation of AppDatabase.
 type appdbimpl struct {
 	db *sql.DB
@@ -58,6 +220,16 @@ type User struct {
 	ID       string
 	Username string
 	PhotoUrl sql.NullString // Now handles NULL values; optional profile photo URL.
+	LastSeen sql.NullString // When the user was last active, if their privacy settings let the reader see it.
+	Nickname sql.NullString // The reader's nickname for the user, if they saved one in their contacts.
+}
+
+// UserSummary is the public profile of a user.
+type UserSummary struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	PhotoUrl string `json:"photoUrl"`
+	LastSeen string `json:"lastSeen,omitempty"`
 }
 
 // Conversation represents a conversation record.
@@ -71,25 +243,47 @@ type Conversation struct {
 	Members            []User         `json:"members"`
 	LastMessageContent sql.NullString `json:"last_message_content"` // New field for the last message content
 	LastMessageSentAt  sql.NullString `json:"last_message_sent_at"` // New field for the last message sent time
+	MessageTTL         int            `json:"messageTtl"`           // Seconds new messages are kept; 0 keeps them forever
+	HasDraft           bool           `json:"hasDraft"`             // Whether the requesting user has a draft here
 }
 
 type Message struct {
-	ID             string       `json:"ID"`
-	ConversationID string       `json:"ConversationID"`
-	SenderID       string       `json:"SenderID"`
-	Content        string       `json:"Content"`
-	ReplyTo        string       `json:"ReplyTo,omitempty"` // Changed to string
-	SentAt         string       `json:"SentAt"`
-	Reactions      []Reaction   `json:"reactions"` // New field for reactions
-	Status         string       `json:"status"`    // "pending", "sent", "delivered", "read"
-	DeliveredAt    sql.NullTime `json:"deliveredAt,omitempty"`
-	ReadAt         sql.NullTime `json:"readAt,omitempty"`
+	ID             string            `json:"ID"`
+	ConversationID string            `json:"ConversationID"`
+	SenderID       string            `json:"SenderID"`
+	Type           string            `json:"type"` // One of the MessageType constants
+	Content        string            `json:"Content"`
+	Payload        json.RawMessage   `json:"payload,omitempty"`      // Type-specific data, see MessageContent
+	Entities       []markup.Entity   `json:"entities,omitempty"`     // Formatting of Content
+	LiveLocation   *LiveLocation     `json:"liveLocation,omitempty"` // Current position of a live location
+	ContactUser    *UserSummary      `json:"contactUser,omitempty"`  // Current profile of the user a contact refers to
+	ReplyTo        string            `json:"ReplyTo,omitempty"`      // Changed to string
+	SentAt         string            `json:"SentAt"`
+	Reactions      []ReactionSummary `json:"reactions"` // Reaction counts per emoji
+	Comments       []Comment         `json:"comments"`
+	LinkPreviews   []LinkPreview     `json:"linkPreviews,omitempty"` // Previews of the URLs in the content, once fetched
+	Status         string            `json:"status"`                 // "pending", "sent", "delivered", "read"
+	DeliveredAt    sql.NullTime      `json:"deliveredAt,omitempty"`
+	ReadAt         sql.NullTime      `json:"readAt,omitempty"`
+	Pinned         bool              `json:"pinned"`
+	PinnedBy       string            `json:"pinnedBy,omitempty"`
+	PinnedAt       string            `json:"pinnedAt,omitempty"`
+	ExpiresAt      string            `json:"expiresAt,omitempty"`
+	Poll           *Poll             `json:"poll,omitempty"` // Set for poll messages
+
+	// Forward provenance. ForwardCount is 0 for messages that were not forwarded.
+	ForwardedFromMessageID string `json:"forwardedFromMessageId,omitempty"`
+	ForwardedFromSenderID  string `json:"forwardedFromSenderId,omitempty"` // Author of the original message
+	ForwardCount           int    `json:"forwardCount"`
+	ForwardedManyTimes     bool   `json:"forwardedManyTimes"`
 }
 
+// Reaction is a single user's reaction to a message.
 type Reaction struct {
-	Reaction string `json:"reaction"`
-	UserName string `json:"userName"`
-	UserID   string `json:"userID"`
+	Reaction  string `json:"reaction"`
+	UserName  string `json:"userName"`
+	UserID    string `json:"userID"`
+	ReactedAt string `json:"reactedAt,omitempty"`
 }
 
 // GetConversationBetween looks for an existing conversation that includes both userID1 and userID2.
@@ -183,14 +377,14 @@ func (db *appdbimpl) GetGroupsByUserID(userID string) ([]Conversation, error) {
 			conv.LastMessageSentAt = lastMsgSentAt
 		}
 
-		// Retrieve members for this group.
+		// Retrieve members for this group. Their photos follow their privacy settings.
 		memberQuery := `
-            SELECT u.id, u.username, u.photo_url
+            SELECT u.id, u.username, ` + visiblePhoto + `
             FROM users u
             INNER JOIN group_members gm ON u.id = gm.user_id
             WHERE gm.group_id = ?
         `
-		memberRows, err := db.db.Query(memberQuery, conv.ID)
+		memberRows, err := db.db.Query(memberQuery, userID, userID, conv.ID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch group members: %w", err)
 		}
@@ -245,10 +439,10 @@ func (db *appdbimpl) CreateGroup(creatorID, groupName, groupPhoto string) (strin
 		return "", fmt.Errorf("conversation creation failed: %w", err)
 	}
 
-	// Add creator as member
+	// Add creator as member and admin
 	_, err = tx.Exec(`INSERT INTO group_members 
-        (group_id, user_id) 
-        VALUES (?, ?)`,
+        (group_id, user_id, is_admin) 
+        VALUES (?, ?, 1)`,
 		groupID, creatorID)
 	if err != nil {
 		return "", fmt.Errorf("member addition failed: %w", err)
@@ -261,38 +455,18 @@ func (db *appdbimpl) CreateGroup(creatorID, groupName, groupPhoto string) (strin
 	return groupID, nil
 }
 
-func (db *appdbimpl) ListUsers() ([]User, error) {
-	rows, err := db.db.Query("SELECT id, username, photo_url FROM users")
-	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
-	}
-	defer rows.Close()
-
-	var users []User
-	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Username, &user.PhotoUrl); err != nil {
-			return nil, fmt.Errorf("failed to scan user: %w", err)
-		}
-		users = append(users, user)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows iteration error: %w", err)
-	}
-	return users, nil
-}
-
-// GetConversation retrieves a conversation and all its messages.
-func (db *appdbimpl) GetConversation(conversationID string) (*Conversation, []Message, error) {
+// GetConversation retrieves a conversation and all its messages. viewerID is used for per-user details such as the
+// viewer's own poll votes.
+func (db *appdbimpl) GetConversation(conversationID, viewerID string) (*Conversation, []Message, error) {
 	// Retrieve conversation details.
 	var conv Conversation
 	// Using sql.NullString for optional fields.
 	var name, groupPhoto sql.NullString
 	err := db.db.QueryRow(`
-        SELECT id, name, is_group, created_at, group_photo 
+        SELECT id, name, is_group, created_at, group_photo, message_ttl 
         FROM conversations 
         WHERE id = ?`, conversationID).
-		Scan(&conv.ID, &name, &conv.IsGroup, &conv.CreatedAt, &groupPhoto)
+		Scan(&conv.ID, &name, &conv.IsGroup, &conv.CreatedAt, &groupPhoto, &conv.MessageTTL)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil, nil // Conversation not found.
 	} else if err != nil {
@@ -311,13 +485,15 @@ func (db *appdbimpl) GetConversation(conversationID string) (*Conversation, []Me
 		conv.PhotoUrl = ""
 	}
 
-	// Retrieve messages for this conversation.
+	// Retrieve messages for this conversation, skipping expired ones the reaper has not deleted yet.
 	var messages []Message
 	rows, err := db.db.Query(`
-	SELECT id, conversation_id, sender_id, content, reply_to, sent_at, status, deliveredAt, readAt 
-	FROM messages 
-	WHERE conversation_id = ? 
-	ORDER BY sent_at ASC`, conversationID)
+	SELECT m.id, m.conversation_id, m.sender_id, m.type, m.content, m.payload, m.entities, m.reply_to, m.sent_at, m.status, m.deliveredAt, m.readAt,
+	       pm.pinned_by, pm.pinned_at, m.expires_at, m.forwarded_from, m.forwarded_from_sender, m.forward_count
+	FROM messages m
+	LEFT JOIN pinned_messages pm ON pm.message_id = m.id AND pm.conversation_id = m.conversation_id
+	WHERE m.conversation_id = ? AND (m.expires_at IS NULL OR m.expires_at > ?)
+	ORDER BY m.sent_at ASC`, conversationID, globaltime.Now().UTC().Format(time.RFC3339))
 	if err != nil {
 		return &conv, messages, fmt.Errorf("failed to query messages: %w", err)
 	}
@@ -325,8 +501,9 @@ func (db *appdbimpl) GetConversation(conversationID string) (*Conversation, []Me
 
 	for rows.Next() {
 		var msg Message
-		var replyTo sql.NullString
-		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.Content, &replyTo, &msg.SentAt, &msg.Status, &msg.DeliveredAt, &msg.ReadAt); err != nil {
+		var payload, entities, replyTo, pinnedBy, pinnedAt, expiresAt, forwardedFrom, forwardedFromSender sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.Type, &msg.Content, &payload, &entities, &replyTo, &msg.SentAt, &msg.Status, &msg.DeliveredAt, &msg.ReadAt, &pinnedBy, &pinnedAt, &expiresAt,
+			&forwardedFrom, &forwardedFromSender, &msg.ForwardCount); err != nil {
 			return &conv, messages, fmt.Errorf("failed to scan message: %w", err)
 		}
 		if replyTo.Valid {
@@ -334,6 +511,17 @@ func (db *appdbimpl) GetConversation(conversationID string) (*Conversation, []Me
 		} else {
 			msg.ReplyTo = ""
 		}
+		if pinnedBy.Valid {
+			msg.Pinned = true
+			msg.PinnedBy = pinnedBy.String
+			msg.PinnedAt = pinnedAt.String
+		}
+		msg.ExpiresAt = expiresAt.String
+		msg.setForwardedFrom(forwardedFrom, forwardedFromSender)
+		if payload.Valid {
+			msg.Payload = json.RawMessage(payload.String)
+		}
+		msg.Entities = decodeEntities(entities)
 		messages = append(messages, msg)
 	}
 	// Check for iteration errors.
@@ -341,53 +529,24 @@ func (db *appdbimpl) GetConversation(conversationID string) (*Conversation, []Me
 		return &conv, messages, fmt.Errorf("rows iteration error: %w", err)
 	}
 
-	// Retrieve reactions for all messages in one query if there are any messages.
 	if len(messages) > 0 {
-		// Build placeholder string for SQL IN clause.
-		placeholders := "?"
-		args := []interface{}{messages[0].ID}
-		for i := 1; i < len(messages); i++ {
-			placeholders += ",?"
-			args = append(args, messages[i].ID)
-		}
-
-		// Query reactions for all message IDs and join to retrieve the username.
-		reactionRows, err := db.db.Query(
-			"SELECT mr.message_id, mr.reaction, u.id, u.username FROM message_reactions mr JOIN users u ON mr.user_id = u.id WHERE mr.message_id IN ("+placeholders+")",
-			args...,
-		)
-		if err != nil {
-			return &conv, messages, fmt.Errorf("failed to query reactions: %w", err)
+		if err := db.attachReactions(messages, viewerID); err != nil {
+			return &conv, messages, err
 		}
-		defer reactionRows.Close()
-
-		// Build a mapping from message ID to a slice of reaction objects.
-		reactionsMap := make(map[string][]Reaction)
-		for reactionRows.Next() {
-			var messageID, reaction, userID, userName string
-			if err := reactionRows.Scan(&messageID, &reaction, &userID, &userName); err != nil {
-				return &conv, messages, fmt.Errorf("failed to scan reaction: %w", err)
-			}
-			reactionsMap[messageID] = append(reactionsMap[messageID], Reaction{
-				Reaction: reaction,
-				UserID:   userID,
-				UserName: userName,
-			})
-
+		if err := db.attachComments(messages); err != nil {
+			return &conv, messages, err
 		}
-
-		if err := reactionRows.Err(); err != nil {
-			return &conv, messages, fmt.Errorf("reaction rows iteration error: %w", err)
+		if err := db.attachLinkPreviews(messages); err != nil {
+			return &conv, messages, err
 		}
-
-		// Attach reactions to each message.
-		for i, msg := range messages {
-			if r, ok := reactionsMap[msg.ID]; ok {
-				// Make sure Message.Reactions is defined to accept these reaction objects.
-				messages[i].Reactions = r
-			} else {
-				messages[i].Reactions = []Reaction{}
-			}
+		if err := db.attachPolls(messages, viewerID); err != nil {
+			return &conv, messages, err
+		}
+		if err := db.attachLiveLocations(messages); err != nil {
+			return &conv, messages, err
+		}
+		if err := db.attachContactUsers(messages, viewerID); err != nil {
+			return &conv, messages, err
 		}
 	}
 
@@ -409,6 +568,18 @@ func New(db *sql.DB) (AppDatabase, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating users table: %w", err)
 	}
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_users_username_nocase ON users (username COLLATE NOCASE, id)")
+	if err != nil {
+		return nil, fmt.Errorf("error creating users index: %w", err)
+	}
+	if _, err := ensureColumn(db, "users", "last_seen_at", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding users.last_seen_at column: %w", err)
+	}
+	for _, column := range []string{"photo_visibility", "last_seen_visibility", "read_receipts_visibility", "messages_visibility"} {
+		if _, err := ensureColumn(db, "users", column, "TEXT NOT NULL DEFAULT '"+VisibleToEveryone+"'"); err != nil {
+			return nil, fmt.Errorf("error adding users.%s column: %w", column, err)
+		}
+	}
 
 	// Create conversations table if not exists.
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS conversations (
@@ -416,23 +587,40 @@ func New(db *sql.DB) (AppDatabase, error) {
 		name TEXT, -- Name of group (NULL for private chats)
 		is_group BOOLEAN NOT NULL DEFAULT 0, -- 0 = Private Chat, 1 = Group Chat
 		group_photo TEXT, -- New column for the group photo URL
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		message_ttl INTEGER NOT NULL DEFAULT 0 -- Seconds new messages are kept (0 = forever)
 	)`)
 	if err != nil {
 		return nil, fmt.Errorf("error creating conversations table: %w", err)
 	}
+	if _, err := ensureColumn(db, "conversations", "message_ttl", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return nil, fmt.Errorf("error adding conversations.message_ttl column: %w", err)
+	}
+	if _, err := ensureColumn(db, "conversations", "requested_by", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding conversations.requested_by column: %w", err)
+	}
+	if _, err := ensureColumn(db, "conversations", "request_status", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, fmt.Errorf("error adding conversations.request_status column: %w", err)
+	}
 
 	// Create messages table if not exists.
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS messages (
 		id TEXT PRIMARY KEY,
 		conversation_id TEXT NOT NULL,
 		sender_id TEXT NOT NULL,
-		content TEXT NOT NULL, -- Message text or media URL
+		type TEXT NOT NULL DEFAULT 'text', -- See the MessageType constants
+		content TEXT NOT NULL, -- Plain-text body, shown in previews
+		payload TEXT, -- Type-specific JSON, see MessageContent
+		entities TEXT, -- JSON formatting entities, see package markup
 		reply_to TEXT NULL, -- If replying to another message
 		sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		status TEXT NOT NULL DEFAULT 'sent',
         deliveredAt DATETIME,
         readAt DATETIME,
+		expires_at TEXT, -- RFC3339 UTC; NULL for messages that never expire
+		forwarded_from TEXT, -- Message this one was forwarded from
+		forwarded_from_sender TEXT, -- Author of the message that started the forward chain
+		forward_count INTEGER NOT NULL DEFAULT 0, -- Number of forwards since the original message
 		FOREIGN KEY (conversation_id) REFERENCES conversations(id),
 		FOREIGN KEY (sender_id) REFERENCES users(id),
 		FOREIGN KEY (reply_to) REFERENCES messages(id) ON DELETE CASCADE
@@ -440,12 +628,46 @@ func New(db *sql.DB) (AppDatabase, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating messages table: %w", err)
 	}
+	if _, err := ensureColumn(db, "messages", "expires_at", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding messages.expires_at column: %w", err)
+	}
+	if _, err := ensureColumn(db, "messages", "payload", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding messages.payload column: %w", err)
+	}
+	if _, err := ensureColumn(db, "messages", "entities", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding messages.entities column: %w", err)
+	}
+	// Messages stored before types existed are classified once, after the remaining tables exist.
+	untypedMessages, err := ensureColumn(db, "messages", "type", "TEXT NOT NULL DEFAULT 'text'")
+	if err != nil {
+		return nil, fmt.Errorf("error adding messages.type column: %w", err)
+	}
+	if _, err := ensureColumn(db, "messages", "forwarded_from", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding messages.forwarded_from column: %w", err)
+	}
+	if _, err := ensureColumn(db, "messages", "forwarded_from_sender", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding messages.forwarded_from_sender column: %w", err)
+	}
+	addedForwardCount, err := ensureColumn(db, "messages", "forward_count", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return nil, fmt.Errorf("error adding messages.forward_count column: %w", err)
+	}
+	if addedForwardCount {
+		if err := migrateForwardCaptions(db); err != nil {
+			return nil, fmt.Errorf("error migrating forwarded messages: %w", err)
+		}
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_messages_expires_at ON messages (expires_at) WHERE expires_at IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating messages expiry index: %w", err)
+	}
 
 	// Create group_members table if not exists.
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS group_members (
 		group_id TEXT NOT NULL,
 		user_id TEXT NOT NULL,
 		joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		is_admin BOOLEAN NOT NULL DEFAULT 0, -- Group admins may pin messages
 		PRIMARY KEY (group_id, user_id),
 		FOREIGN KEY (group_id) REFERENCES conversations(id) ON DELETE CASCADE,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
@@ -454,18 +676,235 @@ func New(db *sql.DB) (AppDatabase, error) {
 		return nil, fmt.Errorf("error creating groups table: %w", err)
 	}
 
+	// Databases created before group admins existed lack the is_admin column. Add it and promote the
+	// earliest member of every group, who is the group's creator.
+	added, err := ensureColumn(db, "group_members", "is_admin", "BOOLEAN NOT NULL DEFAULT 0")
+	if err != nil {
+		return nil, fmt.Errorf("error adding group_members.is_admin column: %w", err)
+	}
+	if added {
+		_, err = db.Exec(`UPDATE group_members SET is_admin = 1
+		WHERE rowid IN (
+			SELECT gm.rowid FROM group_members gm
+			JOIN conversations c ON c.id = gm.group_id
+			WHERE c.is_group = 1
+			  AND gm.joined_at = (SELECT MIN(joined_at) FROM group_members WHERE group_id = gm.group_id)
+		)`)
+		if err != nil {
+			return nil, fmt.Errorf("error promoting group creators to admin: %w", err)
+		}
+	}
+
 	// Create message reactions table if not exists.
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS message_reactions (
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS message_reactions (` + messageReactionsColumns + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating message_reactions table: %w", err)
+	}
+	if err := migrateReactionsKey(db); err != nil {
+		return nil, fmt.Errorf("error migrating message_reactions table: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS message_comments (
+		id TEXT PRIMARY KEY,
 		message_id TEXT NOT NULL,
 		user_id TEXT NOT NULL,
-		reaction TEXT NOT NULL, -- Example: "😂" or "🔥"
-		reacted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		PRIMARY KEY (message_id, user_id),
+		content TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		edited_at TEXT,
 		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	)`)
 	if err != nil {
-		return nil, fmt.Errorf("error creating message_reactions table: %w", err)
+		return nil, fmt.Errorf("error creating message_comments table: %w", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_message_comments_message ON message_comments (message_id)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating message_comments index: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS link_previews (
+		url TEXT PRIMARY KEY,
+		status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'ok' or 'failed'
+		title TEXT,
+		description TEXT,
+		image_url TEXT,
+		site_name TEXT,
+		error TEXT,
+		fetched_at TEXT,
+		created_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating link_previews table: %w", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_link_previews_pending ON link_previews (created_at) WHERE status = 'pending'`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating link_previews index: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS message_links (
+		message_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (message_id, url),
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating message_links table: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS attachments (
+		id TEXT PRIMARY KEY,
+		uploader_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		url TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL DEFAULT '',
+		mime_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		waveform TEXT, -- JSON list of amplitudes, audio only
+		created_at TEXT NOT NULL,
+		FOREIGN KEY (uploader_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating attachments table: %w", err)
+	}
+	if _, err := ensureColumn(db, "attachments", "name", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return nil, fmt.Errorf("error adding attachments.name column: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS uploads (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		mime_type TEXT NOT NULL DEFAULT '',
+		size INTEGER NOT NULL,
+		received INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating uploads table: %w", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_uploads_user ON uploads (user_id)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating uploads index: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS user_blocks (
+		blocker_id TEXT NOT NULL,
+		blocked_id TEXT NOT NULL,
+		blocked_at TEXT NOT NULL,
+		PRIMARY KEY (blocker_id, blocked_id),
+		FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating user_blocks table: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS contacts (
+		owner_id TEXT NOT NULL,
+		contact_id TEXT NOT NULL,
+		nickname TEXT NOT NULL DEFAULT '',
+		favorite BOOLEAN NOT NULL DEFAULT 0,
+		added_at TEXT NOT NULL,
+		PRIMARY KEY (owner_id, contact_id),
+		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (contact_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating contacts table: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sticker_packs (
+		id TEXT PRIMARY KEY,
+		owner_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating sticker_packs table: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS stickers (
+		id TEXT PRIMARY KEY,
+		pack_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		mime_type TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		FOREIGN KEY (pack_id) REFERENCES sticker_packs(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating stickers table: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sticker_emojis (
+		sticker_id TEXT NOT NULL,
+		emoji TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		PRIMARY KEY (sticker_id, emoji),
+		FOREIGN KEY (sticker_id) REFERENCES stickers(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating sticker_emojis table: %w", err)
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_sticker_emojis_emoji ON sticker_emojis (emoji)"); err != nil {
+		return nil, fmt.Errorf("error creating sticker_emojis index: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS installed_sticker_packs (
+		user_id TEXT NOT NULL,
+		pack_id TEXT NOT NULL,
+		installed_at TEXT NOT NULL,
+		PRIMARY KEY (user_id, pack_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (pack_id) REFERENCES sticker_packs(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating installed_sticker_packs table: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sticker_pack_shares (
+		pack_id TEXT NOT NULL,
+		conversation_id TEXT NOT NULL,
+		shared_by TEXT NOT NULL,
+		shared_at TEXT NOT NULL,
+		PRIMARY KEY (pack_id, conversation_id),
+		FOREIGN KEY (pack_id) REFERENCES sticker_packs(id) ON DELETE CASCADE,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating sticker_pack_shares table: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS live_locations (
+		message_id TEXT PRIMARY KEY,
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		accuracy REAL NOT NULL DEFAULT 0,
+		updated_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		ended_at TEXT, -- Set when stopped by the sender or expired
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating live_locations table: %w", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_live_locations_active ON live_locations (expires_at) WHERE ended_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating live_locations index: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS drafts (
+		user_id TEXT NOT NULL,
+		conversation_id TEXT NOT NULL,
+		text TEXT NOT NULL DEFAULT '',
+		reply_to TEXT NOT NULL DEFAULT '',
+		attachments TEXT NOT NULL DEFAULT '[]', -- JSON list of DraftAttachment
+		updated_at TEXT NOT NULL,
+		PRIMARY KEY (user_id, conversation_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating drafts table: %w", err)
 	}
 
 	// In your New() function, after creating other tables, add:
@@ -480,6 +919,119 @@ func New(db *sql.DB) (AppDatabase, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating message_read_receipts table: %w", err)
 	}
+	if _, err := ensureColumn(db, "message_read_receipts", "hidden", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return nil, fmt.Errorf("error adding message_read_receipts.hidden column: %w", err)
+	}
+
+	// Create pinned messages table if not exists.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS pinned_messages (
+		conversation_id TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		pinned_by TEXT NOT NULL,
+		pinned_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (conversation_id, message_id),
+		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+		FOREIGN KEY (pinned_by) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pinned_messages table: %w", err)
+	}
+
+	// Create starred messages table if not exists.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS starred_messages (
+		user_id TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		starred_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, message_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating starred_messages table: %w", err)
+	}
+
+	// Create scheduled messages table if not exists.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS scheduled_messages (
+		id TEXT PRIMARY KEY,
+		sender_id TEXT NOT NULL,
+		receiver_id TEXT NOT NULL DEFAULT '',
+		conversation_id TEXT NOT NULL DEFAULT '',
+		group_id TEXT NOT NULL DEFAULT '',
+		is_group BOOLEAN NOT NULL DEFAULT 0,
+		type TEXT NOT NULL DEFAULT 'text',
+		content TEXT NOT NULL,
+		payload TEXT,
+		entities TEXT,
+		reply_to TEXT NOT NULL DEFAULT '',
+		send_at TEXT NOT NULL, -- RFC3339 UTC, compared as text
+		created_at TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending', -- "pending", "dispatching" or "failed"
+		error TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating scheduled_messages table: %w", err)
+	}
+	if _, err := ensureColumn(db, "scheduled_messages", "type", "TEXT NOT NULL DEFAULT 'text'"); err != nil {
+		return nil, fmt.Errorf("error adding scheduled_messages.type column: %w", err)
+	}
+	if _, err := ensureColumn(db, "scheduled_messages", "payload", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding scheduled_messages.payload column: %w", err)
+	}
+	if _, err := ensureColumn(db, "scheduled_messages", "entities", "TEXT"); err != nil {
+		return nil, fmt.Errorf("error adding scheduled_messages.entities column: %w", err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages (status, send_at)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating scheduled_messages index: %w", err)
+	}
+
+	// A message left "dispatching" was interrupted by a shutdown; let the dispatcher pick it up again.
+	_, err = db.Exec(`UPDATE scheduled_messages SET status = 'pending' WHERE status = 'dispatching'`)
+	if err != nil {
+		return nil, fmt.Errorf("error resetting interrupted scheduled messages: %w", err)
+	}
+
+	// Create poll tables if not exist. A poll is attached to the message holding its question.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS polls (
+		message_id TEXT PRIMARY KEY,
+		multiple_choice BOOLEAN NOT NULL DEFAULT 0,
+		anonymous BOOLEAN NOT NULL DEFAULT 0,
+		closes_at TEXT, -- RFC3339 UTC; NULL for polls that never close
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating polls table: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS poll_options (
+		message_id TEXT NOT NULL,
+		option_index INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		PRIMARY KEY (message_id, option_index),
+		FOREIGN KEY (message_id) REFERENCES polls(message_id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating poll_options table: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS poll_votes (
+		message_id TEXT NOT NULL,
+		option_index INTEGER NOT NULL,
+		user_id TEXT NOT NULL,
+		voted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, option_index, user_id),
+		FOREIGN KEY (message_id, option_index) REFERENCES poll_options(message_id, option_index) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating poll_votes table: %w", err)
+	}
+
+	if untypedMessages {
+		if err := classifyMessageTypes(db); err != nil {
+			return nil, fmt.Errorf("error classifying existing messages: %w", err)
+		}
+	}
 
 	// In database.go - New() function after creating tables:
 	_, err = db.Exec(`CREATE TRIGGER IF NOT EXISTS check_private_members
@@ -497,6 +1049,55 @@ func New(db *sql.DB) (AppDatabase, error) {
 	return &appdbimpl{db: db}, nil
 }
 
+// nullablePayload converts an empty payload to NULL for storage.
+func nullablePayload(payload json.RawMessage) interface{} {
+	if len(payload) == 0 {
+		return nil
+	}
+	return string(payload)
+}
+
+// messageReactionsColumns defines the message_reactions table. A user may react to a message with several emoji.
+const messageReactionsColumns = `
+		message_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		reaction TEXT NOT NULL, -- Example: "😂" or "🔥"
+		reacted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id, reaction),
+		FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	`
+
+// ensureColumn adds a column to an existing table if it is missing, since CREATE TABLE IF NOT EXISTS leaves tables
+// created by older versions untouched. It reports whether the column was added.
+func ensureColumn(db *sql.DB, table, column, definition string) (bool, error) {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return false, fmt.Errorf("failed to read table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		return false, fmt.Errorf("failed to add column: %w", err)
+	}
+	return true, nil
+}
+
 // CreateUser inserts a new user.
 func (db *appdbimpl) CreateUser(username string) (string, error) {
 	// Generate a new UUID for the user.
@@ -583,7 +1184,8 @@ func GenerateNewID() (string, error) {
 	return uid.String(), nil
 }
 
-// GetConversationsByUserID retrieves all conversations associated with a user.
+// GetConversationsByUserID retrieves all conversations associated with a user. The last message is the latest one
+// that has not expired.
 func (db *appdbimpl) GetConversationsByUserID(userID string) ([]Conversation, error) {
 	query := `
     SELECT 
@@ -593,18 +1195,22 @@ func (db *appdbimpl) GetConversationsByUserID(userID string) ([]Conversation, er
       c.created_at, 
       c.group_photo,
       COALESCE(
-        (SELECT content FROM messages WHERE conversation_id = c.id ORDER BY sent_at DESC LIMIT 1), 
+        (SELECT content FROM messages m WHERE m.conversation_id = c.id AND (m.expires_at IS NULL OR m.expires_at > ?)
+         ORDER BY m.sent_at DESC LIMIT 1), 
         ''
       ) AS last_message_content,
       COALESCE(
-        (SELECT sent_at FROM messages WHERE conversation_id = c.id ORDER BY sent_at DESC LIMIT 1), 
+        (SELECT sent_at FROM messages m WHERE m.conversation_id = c.id AND (m.expires_at IS NULL OR m.expires_at > ?)
+         ORDER BY m.sent_at DESC LIMIT 1), 
         ''
-      ) AS last_message_sent_at
+      ) AS last_message_sent_at,
+      EXISTS (SELECT 1 FROM drafts d WHERE d.conversation_id = c.id AND d.user_id = gm.user_id) AS has_draft
     FROM conversations c
     JOIN group_members gm ON c.id = gm.group_id
-    WHERE gm.user_id = ?
+    WHERE gm.user_id = ? AND NOT ` + hiddenRequestCondition + `
   `
-	rows, err := db.db.Query(query, userID)
+	now := globaltime.Now().UTC().Format(time.RFC3339)
+	rows, err := db.db.Query(query, now, now, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch conversations: %w", err)
 	}
@@ -623,6 +1229,7 @@ func (db *appdbimpl) GetConversationsByUserID(userID string) ([]Conversation, er
 			&groupPhoto,
 			&conv.LastMessageContent, // Now scanned as string (with COALESCE, never NULL)
 			&conv.LastMessageSentAt,  // Now scanned as string too.
+			&conv.HasDraft,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan conversation: %w", err)
 		}
@@ -645,36 +1252,90 @@ func (db *appdbimpl) GetConversationsByUserID(userID string) ([]Conversation, er
 }
 
 // SendMessage inserts a new message and returns the generated messageID and conversationID.
-// If conversationID is empty, creates a new conversation for the users.
-func (db *appdbimpl) SendMessage(userID, receiverID, content string, isGroup bool, groupID, conversationID, replyTo string) (string, string, error) {
+// If conversationID is empty, creates a new conversation for the users. Everything is written in one transaction.
+func (db *appdbimpl) SendMessage(userID, receiverID string, content MessageContent, isGroup bool, groupID, conversationID, replyTo string) (string, string, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return "", "", fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", rbErr)
+		}
+	}()
+
+	messageID, conversationID, err := db.sendMessage(tx, userID, receiverID, content, isGroup, conversationID, replyTo)
+	if err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return messageID, conversationID, nil
+}
+
+// sendMessage does the work of SendMessage in the transaction tx, which the caller commits.
+func (db *appdbimpl) sendMessage(tx *sql.Tx, userID, receiverID string, content MessageContent, isGroup bool, conversationID, replyTo string) (string, string, error) {
+	var err error
+	if err := resolveAttachment(tx, &content, userID); err != nil {
+		return "", "", err
+	}
+	if err := resolveSticker(tx, &content, userID); err != nil {
+		return "", "", err
+	}
+	if err := content.Normalize(); err != nil {
+		return "", "", err
+	}
+	if err := checkContactUser(tx, content); err != nil {
+		return "", "", err
+	}
+	if err := applyAttachmentMetadata(tx, &content); err != nil {
+		return "", "", err
+	}
+
 	// For private messages, check if a conversation already exists.
 	if !isGroup {
 		if conversationID == "" {
-			existingConv, err := db.GetPrivateConversation(userID, receiverID)
+			conversationID, err = privateConversationID(tx, userID, receiverID)
 			if err != nil {
 				return "", "", fmt.Errorf("error checking for existing conversation: %w", err)
 			}
-			if existingConv != nil {
-				conversationID = existingConv.ID
-			} else {
-				conversationID, err = db.createConversation(userID, receiverID)
+			if conversationID == "" {
+				conversationID, err = db.createConversation(tx, userID, receiverID)
 				if err != nil {
 					return "", "", fmt.Errorf("failed to create conversation: %w", err)
 				}
 			}
 		}
 	}
+	if err := checkConversationBlocked(tx, conversationID, userID); err != nil {
+		return "", "", err
+	}
+	// Replying to a message request accepts it.
+	if err := acceptOnReply(tx, conversationID, userID); err != nil {
+		return "", "", err
+	}
 
 	newMessageID, err := GenerateNewID()
 	if err != nil {
 		return "", "", fmt.Errorf("GenerateNewID error: %w", err)
 	}
 
-	currentTime := time.Now().UTC().Format(time.RFC3339)
+	now := globaltime.Now().UTC()
+	currentTime := now.Format(time.RFC3339)
+	expiresAt, err := messageExpiry(tx, conversationID, now)
+	if err != nil {
+		return "", "", err
+	}
+
+	entities, err := encodeEntities(content.Entities)
+	if err != nil {
+		return "", "", err
+	}
 
 	// Updated query to include reply_to column.
-	query := `INSERT INTO messages (id, conversation_id, sender_id, content, reply_to, sent_at) VALUES (?, ?, ?, ?, ?, ?)`
-	result, err := db.db.Exec(query, newMessageID, conversationID, userID, content, replyTo, currentTime)
+	query := `INSERT INTO messages (id, conversation_id, sender_id, type, content, payload, entities, reply_to, sent_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, newMessageID, conversationID, userID, content.Type, content.Body, nullablePayload(content.Payload), entities, replyTo, currentTime, expiresAt)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to insert message, query error: %w", err)
 	}
@@ -687,11 +1348,37 @@ func (db *appdbimpl) SendMessage(userID, receiverID, content string, isGroup boo
 		return "", "", fmt.Errorf("no rows affected")
 	}
 
+	if err := startLiveLocation(tx, newMessageID, content, now); err != nil {
+		return "", "", err
+	}
+
+	// The message is sent even if its links can't be queued; it just won't get previews.
+	if content.Type == MessageTypeText {
+		if err := queueLinkPreviews(tx, newMessageID, linkText(content), now); err != nil {
+			log.Printf("failed to queue link previews for message %s: %v", newMessageID, err)
+		}
+	}
+
 	return newMessageID, conversationID, nil
 }
 
-// createConversation creates a new conversation between two users and returns the new conversation ID.
-func (db *appdbimpl) createConversation(userID, receiverID string) (string, error) {
+// createConversation creates a new conversation between two users and returns the new conversation ID, or ErrBlocked
+// if either blocked the other. If the receiver's privacy settings do not let userID message them, the conversation
+// is a message request. It runs on q, which may be a transaction.
+func (db *appdbimpl) createConversation(q dbtx, userID, receiverID string) (string, error) {
+	if err := checkBlocked(q, userID, receiverID); err != nil {
+		return "", err
+	}
+	allowed, err := messagingAllowed(q, userID, receiverID)
+	if err != nil {
+		return "", err
+	}
+	var requestedBy interface{}
+	requestStatus := ""
+	if !allowed {
+		requestedBy, requestStatus = userID, requestPending
+	}
+
 	// Generate a unique conversation ID.
 	newConversationID, err := GenerateNewID()
 	if err != nil {
@@ -700,19 +1387,19 @@ func (db *appdbimpl) createConversation(userID, receiverID string) (string, erro
 
 	// Insert a new conversation record into the conversations table.
 	// For a private conversation, you might leave the name blank.
-	query := `INSERT INTO conversations (id, name, is_group, created_at) VALUES (?, ?, 0, ?)`
+	query := `INSERT INTO conversations (id, name, is_group, created_at, requested_by, request_status) VALUES (?, ?, 0, ?, ?, ?)`
 	currentTime := time.Now().UTC().Format(time.RFC3339)
-	_, err = db.db.Exec(query, newConversationID, "", currentTime)
+	_, err = q.Exec(query, newConversationID, "", currentTime, requestedBy, requestStatus)
 	if err != nil {
 		return "", fmt.Errorf("failed to insert conversation: %w", err)
 	}
 
 	// Add both users as members of this private conversation.
-	_, err = db.db.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)", newConversationID, userID)
+	_, err = q.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)", newConversationID, userID)
 	if err != nil {
 		return "", fmt.Errorf("failed to add creator to conversation: %w", err)
 	}
-	_, err = db.db.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)", newConversationID, receiverID)
+	_, err = q.Exec("INSERT INTO group_members (group_id, user_id) VALUES (?, ?)", newConversationID, receiverID)
 	if err != nil {
 		return "", fmt.Errorf("failed to add receiver to conversation: %w", err)
 	}
@@ -722,57 +1409,33 @@ func (db *appdbimpl) createConversation(userID, receiverID string) (string, erro
 
 // (Duplicate GenerateNewID function removed)
 
-// ForwardMessage forwards a message to another conversation.
-func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, senderID string) (string, error) {
-	// Retrieve the original message content.
-	var originalContent string
-	err := db.db.QueryRow("SELECT content FROM messages WHERE id = ?", originalMessageID).
-		Scan(&originalContent)
-	if err != nil {
-		return "", fmt.Errorf("failed to retrieve original message: %w", err)
+// AddReaction adds a reaction to a message. A user may react with several emoji; repeating a reaction is a
+// no-op. The user must be a member of the message's conversation.
+func (db *appdbimpl) AddReaction(messageID, userID, reaction string) error {
+	if !validReaction(reaction) {
+		return ErrInvalidReaction
 	}
-
-	newMessageID, err := GenerateNewID()
+	conversationID, err := db.messageConversationID(messageID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate new message ID: %w", err)
+		return err
 	}
-
-	trimmed := strings.TrimSpace(originalContent)
-	var newContent string
-	if strings.HasPrefix(trimmed, "data:image") {
-		// Wrap the image with a caption as HTML.
-		newContent = fmt.Sprintf(`<div class="forward-caption">Forwarded from you:</div><img src="%s" alt="Image message" class="sent-image" />`, trimmed)
-	} else {
-		newContent = fmt.Sprintf("Forwarded from you: %s", originalContent)
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return err
 	}
 
 	currentTime := time.Now().UTC().Format(time.RFC3339)
 	_, err = db.db.Exec(
-		"INSERT INTO messages (id, conversation_id, sender_id, content, reply_to, sent_at) VALUES (?, ?, ?, ?, ?, ?)",
-		newMessageID, targetConversationID, senderID, newContent, nil, currentTime)
-	if err != nil {
-		return "", fmt.Errorf("failed to insert forwarded message: %w", err)
-	}
-
-	return newMessageID, nil
-}
-
-// CommentMessage inserts a reaction (comment) for a message into the message_reactions table.
-func (db *appdbimpl) CommentMessage(messageID, userID, reaction string) error {
-	_, err := db.db.Exec(
-		"INSERT OR REPLACE INTO message_reactions (message_id, user_id, reaction) VALUES (?, ?, ?)",
-		messageID, userID, reaction,
+		"INSERT OR IGNORE INTO message_reactions (message_id, user_id, reaction, reacted_at) VALUES (?, ?, ?, ?)",
+		messageID, userID, reaction, currentTime,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to add comment: %w", err)
+		return fmt.Errorf("failed to add reaction: %w", err)
 	}
 	return nil
 }
 
-// UncommentMessage removes a reaction (comment) for a message from the message_reactions table.
-func (db *appdbimpl) UncommentMessage(messageID, userID string) error {
-	log.Printf("Deleting reaction for message %s, user %s", messageID, userID)
-
+// RemoveReactions removes all of the user's reactions to a message.
+func (db *appdbimpl) RemoveReactions(messageID, userID string) error {
 	query := "DELETE FROM message_reactions WHERE message_id = ? AND user_id = ?"
 	result, err := db.db.Exec(query, messageID, userID)
 	if err != nil {
@@ -783,24 +1446,38 @@ func (db *appdbimpl) UncommentMessage(messageID, userID string) error {
 		return fmt.Errorf("failed to check deletion: %w", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("reaction not found")
+		return ErrReactionNotFound
 	}
 	return nil
 }
 
-// DeleteMessage removes a message from the messages table.
+// DeleteMessage removes a message of the sender, together with the rows listed in messageDependentTables, in one
+// transaction.
 func (db *appdbimpl) DeleteMessage(messageID, senderID string) error {
-	res, err := db.db.Exec("DELETE FROM messages WHERE id = ? AND sender_id = ?", messageID, senderID)
+	tx, err := db.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to delete message: %w", err)
+		return fmt.Errorf("transaction start failed: %w", err)
 	}
-	affected, err := res.RowsAffected()
+	defer func() {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", rbErr)
+		}
+	}()
+
+	var owned bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM messages WHERE id = ? AND sender_id = ?)", messageID, senderID).Scan(&owned)
 	if err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
-	if affected == 0 {
+	if !owned {
 		return fmt.Errorf("no message deleted (perhaps invalid message ID or sender mismatch)")
 	}
+	if err := purgeMessages(tx, []string{messageID}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
 	return nil
 }
 
@@ -869,25 +1546,76 @@ func (db *appdbimpl) SetGroupPhoto(groupID, photoUrl string) error {
 	return nil
 }
 
-// GetChatPartner returns the user (other than currentUserID) in the private conversation.
+// GetChatPartner returns the user (other than currentUserID) in the private conversation, with the nickname
+// currentUserID gave them, if any.
 func (db *appdbimpl) GetChatPartner(conversationID, currentUserID string) (*User, error) {
 	// This query joins the group_members and users tables to find the other user.
+	// The photo and last seen time are left out unless the partner's privacy settings show them.
 	row := db.db.QueryRow(
-		`SELECT u.id, u.username, u.photo_url
+		`SELECT u.id, u.username,
+			`+visiblePhoto+`,
+			CASE WHEN `+visibleTo("last_seen_visibility")+` THEN u.last_seen_at END,
+			NULLIF(ct.nickname, '')
 		 FROM group_members gm
 		 JOIN users u ON gm.user_id = u.id
+		 LEFT JOIN contacts ct ON ct.owner_id = ? AND ct.contact_id = u.id
 		 WHERE gm.group_id = ? AND u.id != ?
 		 LIMIT 1`,
-		conversationID, currentUserID,
+		currentUserID, currentUserID, currentUserID, currentUserID, currentUserID, conversationID, currentUserID,
 	)
 	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.PhotoUrl)
+	err := row.Scan(&user.ID, &user.Username, &user.PhotoUrl, &user.LastSeen, &user.Nickname)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// messageConversationID returns the conversation a message belongs to, or ErrMessageNotFound.
+func (db *appdbimpl) messageConversationID(messageID string) (string, error) {
+	var conversationID string
+	err := db.db.QueryRow("SELECT conversation_id FROM messages WHERE id = ?", messageID).Scan(&conversationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMessageNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("failed to look up message: %w", err)
+	}
+	return conversationID, nil
+}
+
+// checkMember returns ErrNotMember unless userID belongs to the conversation.
+func (db *appdbimpl) checkMember(conversationID, userID string) error {
+	var count int
+	err := db.db.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?", conversationID, userID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("membership check failed: %w", err)
+	}
+	if count == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// checkModerator returns nil if userID may moderate the conversation: any member of a private chat, or an
+// admin of a group. It returns ErrNotMember or ErrNotAdmin otherwise.
+func (db *appdbimpl) checkModerator(conversationID, userID string) error {
+	var isGroup, isAdmin bool
+	err := db.db.QueryRow(`
+		SELECT c.is_group, gm.is_admin
+		FROM conversations c
+		JOIN group_members gm ON gm.group_id = c.id
+		WHERE c.id = ? AND gm.user_id = ?`, conversationID, userID).Scan(&isGroup, &isAdmin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotMember
+	} else if err != nil {
+		return fmt.Errorf("membership check failed: %w", err)
+	}
+	if isGroup && !isAdmin {
+		return ErrNotAdmin
+	}
+	return nil
+}
+
 // GetPrivateConversation looks for an existing private conversation between two users.
 func (db *appdbimpl) GetPrivateConversation(userID, receiverID string) (*Conversation, error) {
 	// Adjust this SQL according to your schema and how you store private conversations.
@@ -922,20 +1650,34 @@ func (db *appdbimpl) UpdateMessageStatus(messageID, status, userID string) error
 		_, err := db.db.Exec(query, status, currentTime, messageID)
 		return err
 	} else if status == "read" {
-		// Insert (or replace) a read receipt for the current user.
-		_, err := db.db.Exec(
-			"INSERT OR REPLACE INTO message_read_receipts (message_id, user_id, read_at) VALUES (?, ?, ?)",
-			messageID, userID, currentTime,
-		)
+		// Retrieve the conversation ID and sender of this message.
+		var conversationID, senderID string
+		err := db.db.QueryRow("SELECT conversation_id, sender_id FROM messages WHERE id = ?", messageID).Scan(&conversationID, &senderID)
 		if err != nil {
-			return fmt.Errorf("failed to insert read receipt: %w", err)
+			return fmt.Errorf("failed to retrieve conversation id: %w", err)
 		}
 
-		// Retrieve the conversation ID for this message.
-		var conversationID string
-		err = db.db.QueryRow("SELECT conversation_id FROM messages WHERE id = ?", messageID).Scan(&conversationID)
+		// Insert (or replace) a read receipt for the current user. Receipts the reader's privacy settings hide from
+		// the sender, and reads of message requests not accepted yet, record the reader's own read state but are
+		// not reported.
+		visible, err := readReceiptsVisible(db.db, userID, senderID)
 		if err != nil {
-			return fmt.Errorf("failed to retrieve conversation id: %w", err)
+			return err
+		}
+		if request, err := isReceivedRequest(db.db, conversationID, userID); err != nil {
+			return err
+		} else if request {
+			visible = false
+		}
+		_, err = db.db.Exec(
+			"INSERT OR REPLACE INTO message_read_receipts (message_id, user_id, read_at, hidden) VALUES (?, ?, ?, ?)",
+			messageID, userID, currentTime, !visible,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert read receipt: %w", err)
+		}
+		if !visible {
+			return nil
 		}
 
 		// Check if this conversation is a group chat.
@@ -960,7 +1702,7 @@ func (db *appdbimpl) UpdateMessageStatus(messageID, status, userID string) error
 
 			// Count the number of read receipts for this message.
 			var totalRead int
-			err = db.db.QueryRow("SELECT COUNT(*) FROM message_read_receipts WHERE message_id = ?", messageID).Scan(&totalRead)
+			err = db.db.QueryRow("SELECT COUNT(*) FROM message_read_receipts WHERE message_id = ? AND NOT hidden", messageID).Scan(&totalRead)
 			if err != nil {
 				return fmt.Errorf("failed to count read receipts: %w", err)
 			}
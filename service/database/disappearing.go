@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// messageExpiry returns the expiry time for a message sent now in the conversation, or nil if the conversation
+// keeps its messages forever.
+func messageExpiry(q dbtx, conversationID string, now time.Time) (interface{}, error) {
+	var ttl int
+	err := q.QueryRow("SELECT message_ttl FROM conversations WHERE id = ?", conversationID).Scan(&ttl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read conversation message TTL: %w", err)
+	}
+	if ttl <= 0 {
+		return nil, nil
+	}
+	return now.Add(time.Duration(ttl) * time.Second).UTC().Format(time.RFC3339), nil
+}
+
+// SetConversationTTL sets how many seconds new messages of the conversation are kept. Messages already sent keep
+// their expiry.
+func (db *appdbimpl) SetConversationTTL(conversationID, userID string, ttlSeconds int) error {
+	if err := db.checkModerator(conversationID, userID); err != nil {
+		return err
+	}
+	_, err := db.db.Exec("UPDATE conversations SET message_ttl = ? WHERE id = ?", ttlSeconds, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to update message TTL: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredMessages deletes up to limit messages that expired before now, together with the rows listed in
+// messageDependentTables.
+func (db *appdbimpl) DeleteExpiredMessages(now time.Time, limit int) (int, error) {
+	rows, err := db.db.Query(
+		"SELECT id FROM messages WHERE expires_at IS NOT NULL AND expires_at <= ? LIMIT ?",
+		now.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query expired messages: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan expired message: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("rows iteration error: %w", err)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", rbErr)
+		}
+	}()
+
+	if err := purgeMessages(tx, ids); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return len(ids), nil
+}
+
+// messageDependentTables lists the tables holding per-message data, keyed by a message_id column. Foreign keys are
+// not enforced on the connection, so these rows must be deleted explicitly along with their message.
+var messageDependentTables = []string{
+	"message_reactions",
+	"message_comments",
+	"message_links",
+	"live_locations",
+	"message_read_receipts",
+	"pinned_messages",
+	"starred_messages",
+	"poll_votes",
+	"poll_options",
+	"polls",
+}
+
+// purgeMessages deletes the given messages and every row in messageDependentTables referring to them.
+func purgeMessages(tx *sql.Tx, ids []string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	for _, table := range messageDependentTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE message_id IN ("+placeholders+")", args...); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM messages WHERE id IN ("+placeholders+")", args...); err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+	return nil
+}
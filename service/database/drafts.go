@@ -0,0 +1,157 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// maxDraftAttachments is the maximum number of attachments of a draft.
+const maxDraftAttachments = 10
+
+// ErrInvalidDraft is returned for drafts whose text is too long or whose attachments are not valid message content.
+var ErrInvalidDraft = errors.New("invalid draft")
+
+// ErrDraftNotFound is returned when the user has no draft in the conversation.
+var ErrDraftNotFound = errors.New("draft not found")
+
+// Draft is a message a user is composing in a conversation. It is kept per user so that any of their devices can
+// pick it up.
+type Draft struct {
+	ConversationID string            `json:"conversationId"`
+	Text           string            `json:"text"`
+	ReplyTo        string            `json:"replyTo,omitempty"`
+	Attachments    []DraftAttachment `json:"attachments"`
+	UpdatedAt      string            `json:"updatedAt"`
+}
+
+// DraftAttachment is a non-text item of a draft, with the same type and payload it will be sent with.
+type DraftAttachment struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// normalize validates the draft and canonicalizes its attachments like MessageContent.Normalize does.
+func (d *Draft) normalize() error {
+	if len(d.Text) > MaxBodyLength {
+		return fmt.Errorf("%w: text longer than %d characters", ErrInvalidDraft, MaxBodyLength)
+	}
+	if len(d.Attachments) > maxDraftAttachments {
+		return fmt.Errorf("%w: more than %d attachments", ErrInvalidDraft, maxDraftAttachments)
+	}
+	for i, a := range d.Attachments {
+		switch a.Type {
+		case MessageTypeText, MessageTypePoll, MessageTypeSystem, "":
+			return fmt.Errorf("%w: attachments cannot be of type %q", ErrInvalidDraft, a.Type)
+		}
+		content := MessageContent{Type: a.Type, Payload: a.Payload}
+		if err := content.Normalize(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDraft, err)
+		}
+		d.Attachments[i].Payload = content.Payload
+	}
+	if d.Attachments == nil {
+		d.Attachments = []DraftAttachment{}
+	}
+	return nil
+}
+
+// isEmpty reports whether the draft holds nothing worth keeping.
+func (d *Draft) isEmpty() bool {
+	return d.Text == "" && d.ReplyTo == "" && len(d.Attachments) == 0
+}
+
+// SaveDraft replaces the user's draft in a conversation they are a member of. Saving an empty draft deletes it.
+func (db *appdbimpl) SaveDraft(conversationID, userID string, draft Draft) (Draft, error) {
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return Draft{}, err
+	}
+	if err := draft.normalize(); err != nil {
+		return Draft{}, err
+	}
+	if draft.ReplyTo != "" {
+		replyConversationID, err := db.messageConversationID(draft.ReplyTo)
+		if err != nil {
+			return Draft{}, err
+		}
+		if replyConversationID != conversationID {
+			return Draft{}, ErrMessageNotFound
+		}
+	}
+
+	draft.ConversationID = conversationID
+	draft.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if draft.isEmpty() {
+		if err := clearDraft(db.db, conversationID, userID); err != nil {
+			return Draft{}, err
+		}
+		return draft, nil
+	}
+
+	attachments, err := json.Marshal(draft.Attachments)
+	if err != nil {
+		return Draft{}, fmt.Errorf("failed to encode draft attachments: %w", err)
+	}
+	_, err = db.db.Exec(`INSERT INTO drafts (user_id, conversation_id, text, reply_to, attachments, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, conversation_id) DO UPDATE SET
+			text = excluded.text, reply_to = excluded.reply_to, attachments = excluded.attachments,
+			updated_at = excluded.updated_at`,
+		userID, conversationID, draft.Text, draft.ReplyTo, string(attachments), draft.UpdatedAt)
+	if err != nil {
+		return Draft{}, fmt.Errorf("failed to save draft: %w", err)
+	}
+	return draft, nil
+}
+
+// GetDraft returns the user's draft in a conversation.
+func (db *appdbimpl) GetDraft(conversationID, userID string) (Draft, error) {
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return Draft{}, err
+	}
+
+	draft := Draft{ConversationID: conversationID}
+	var attachments string
+	err := db.db.QueryRow(
+		"SELECT text, reply_to, attachments, updated_at FROM drafts WHERE user_id = ? AND conversation_id = ?",
+		userID, conversationID).Scan(&draft.Text, &draft.ReplyTo, &attachments, &draft.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Draft{}, ErrDraftNotFound
+	} else if err != nil {
+		return Draft{}, fmt.Errorf("failed to get draft: %w", err)
+	}
+	if err := json.Unmarshal([]byte(attachments), &draft.Attachments); err != nil {
+		log.Printf("failed to decode attachments of draft in %s: %v", conversationID, err)
+	}
+	if draft.Attachments == nil {
+		draft.Attachments = []DraftAttachment{}
+	}
+	return draft, nil
+}
+
+// DeleteDraft discards the user's draft in a conversation.
+func (db *appdbimpl) DeleteDraft(conversationID, userID string) error {
+	res, err := db.db.Exec("DELETE FROM drafts WHERE user_id = ? AND conversation_id = ?", userID, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete draft: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete draft: %w", err)
+	}
+	if affected == 0 {
+		return ErrDraftNotFound
+	}
+	return nil
+}
+
+// clearDraft deletes the user's draft in a conversation, if any.
+func clearDraft(q dbtx, conversationID, userID string) error {
+	if _, err := q.Exec("DELETE FROM drafts WHERE user_id = ? AND conversation_id = ?", userID, conversationID); err != nil {
+		return fmt.Errorf("failed to clear draft: %w", err)
+	}
+	return nil
+}
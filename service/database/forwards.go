@@ -0,0 +1,280 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+// dbtx is the part of *sql.DB and *sql.Tx used by helpers that may run inside a transaction.
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// frequentlyForwardedThreshold is the forward count from which a message is flagged as forwarded many times.
+const frequentlyForwardedThreshold = 5
+
+// setForwardedFrom fills in the forward provenance read from messages.forwarded_from and forwarded_from_sender.
+// msg.ForwardCount must already be set.
+func (msg *Message) setForwardedFrom(messageID, senderID sql.NullString) {
+	msg.ForwardedFromMessageID = messageID.String
+	msg.ForwardedFromSenderID = senderID.String
+	msg.ForwardedManyTimes = msg.ForwardCount >= frequentlyForwardedThreshold
+}
+
+// legacyForwardPrefix is the caption ForwardMessage used to prepend to forwarded text.
+const legacyForwardPrefix = "Forwarded from you: "
+
+// migrateForwardCaptions turns the captions that ForwardMessage used to write into messages into forward metadata.
+// Text loses its prefix; forwarded images keep their HTML until classifyMessageTypes unwraps them. The original
+// message of these forwards is unknown.
+func migrateForwardCaptions(db *sql.DB) error {
+	_, err := db.Exec(`UPDATE messages SET forward_count = 1
+		WHERE substr(content, 1, ?) = ? OR content LIKE '<div class="forward-caption">%'`,
+		len(legacyForwardPrefix), legacyForwardPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to mark forwarded messages: %w", err)
+	}
+	_, err = db.Exec(`UPDATE messages SET content = substr(content, ?) WHERE substr(content, 1, ?) = ?`,
+		len(legacyForwardPrefix)+1, len(legacyForwardPrefix), legacyForwardPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to strip forward captions: %w", err)
+	}
+	return nil
+}
+
+// ForwardResult is the outcome of forwarding a message to one target. Exactly one of ConversationID and UserID is
+// set as given in the request; ConversationID is filled in for user targets that were forwarded to. If the target
+// was skipped, Err is the reason and Error its message.
+type ForwardResult struct {
+	ConversationID string `json:"conversationId,omitempty"`
+	UserID         string `json:"userId,omitempty"`
+	MessageID      string `json:"messageId,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Err            error  `json:"-"`
+}
+
+// skip records that the target was skipped because of err.
+func (r *ForwardResult) skip(err error) {
+	r.Err = err
+	r.Error = err.Error()
+}
+
+// forwardSource is the message being forwarded.
+type forwardSource struct {
+	ID             string
+	ConversationID string
+	Type           string
+	Content        string
+	Payload        sql.NullString
+	Entities       sql.NullString
+	SenderID       string // Author of the original message of the forward chain
+	ForwardCount   int
+}
+
+// ForwardMessage forwards a message to another conversation. The content is copied verbatim; the copy records the
+// message it was forwarded from, the author of the original message and how many times the content was forwarded.
+// The sender must be a member of both conversations.
+func (db *appdbimpl) ForwardMessage(originalMessageID, targetConversationID, senderID string) (string, error) {
+	results, err := db.ForwardMessageToMany(originalMessageID, senderID, []string{targetConversationID}, nil)
+	if err != nil {
+		return "", err
+	}
+	if results[0].Err != nil {
+		return "", results[0].Err
+	}
+	return results[0].MessageID, nil
+}
+
+// ForwardMessageToMany forwards a message to existing conversations and to users, creating private conversations
+// with users the sender has not talked to yet. All forwards are written in one transaction. Targets the sender may
+// not post to, including private chats with blocked users, are skipped and reported in their result; a target reached
+// twice, such as a conversation also named through its user, gets a single copy. The sender must be able to read the
+// original message.
+func (db *appdbimpl) ForwardMessageToMany(originalMessageID, senderID string, conversationIDs, userIDs []string) ([]ForwardResult, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", rbErr)
+		}
+	}()
+
+	now := globaltime.Now().UTC()
+	src, err := loadForwardSource(tx, originalMessageID, senderID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ForwardResult, 0, len(conversationIDs)+len(userIDs))
+	forwarded := make(map[string]string) // Conversation ID to the ID of its copy
+	forwardTo := func(result ForwardResult) (ForwardResult, error) {
+		if messageID, ok := forwarded[result.ConversationID]; ok {
+			result.MessageID = messageID
+			return result, nil
+		}
+		messageID, err := insertForward(tx, src, result.ConversationID, senderID, now)
+		if err != nil {
+			return result, err
+		}
+		forwarded[result.ConversationID] = messageID
+		result.MessageID = messageID
+		return result, nil
+	}
+
+	for _, conversationID := range conversationIDs {
+		result := ForwardResult{ConversationID: conversationID}
+		var member bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?)",
+			conversationID, senderID).Scan(&member)
+		if err != nil {
+			return nil, fmt.Errorf("membership check failed: %w", err)
+		}
+		if !member {
+			result.skip(ErrNotMember)
+			results = append(results, result)
+			continue
+		}
+		if err := checkConversationBlocked(tx, conversationID, senderID); errors.Is(err, ErrBlocked) {
+			result.skip(err)
+			results = append(results, result)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if result, err = forwardTo(result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	for _, userID := range userIDs {
+		result := ForwardResult{UserID: userID}
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to look up user: %w", err)
+		}
+		if !exists || userID == senderID {
+			result.skip(ErrUserNotFound)
+			results = append(results, result)
+			continue
+		}
+		if err := checkBlocked(tx, senderID, userID); errors.Is(err, ErrBlocked) {
+			result.skip(err)
+			results = append(results, result)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		conversationID, err := privateConversationID(tx, senderID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if conversationID == "" {
+			if conversationID, err = db.createConversation(tx, senderID, userID); err != nil {
+				return nil, fmt.Errorf("failed to create conversation: %w", err)
+			}
+		}
+		result.ConversationID = conversationID
+		if result, err = forwardTo(result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return results, nil
+}
+
+// loadForwardSource reads the message to forward. Messages the sender cannot see, because they are not in its
+// conversation or the message has expired, are reported as ErrNotMember and ErrMessageNotFound.
+func loadForwardSource(q dbtx, messageID, senderID string, now time.Time) (forwardSource, error) {
+	src := forwardSource{ID: messageID}
+	var originalSender sql.NullString
+	err := q.QueryRow(`SELECT conversation_id, type, content, payload, entities, sender_id, forwarded_from_sender, forward_count
+		FROM messages WHERE id = ? AND (expires_at IS NULL OR expires_at > ?)`, messageID, now.UTC().Format(time.RFC3339)).
+		Scan(&src.ConversationID, &src.Type, &src.Content, &src.Payload, &src.Entities, &src.SenderID, &originalSender, &src.ForwardCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return src, ErrMessageNotFound
+	} else if err != nil {
+		return src, fmt.Errorf("failed to retrieve original message: %w", err)
+	}
+
+	var member bool
+	err = q.QueryRow("SELECT EXISTS (SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?)",
+		src.ConversationID, senderID).Scan(&member)
+	if err != nil {
+		return src, fmt.Errorf("membership check failed: %w", err)
+	}
+	if !member {
+		return src, ErrNotMember
+	}
+
+	// A forward of a forward keeps pointing at the author of the first message.
+	if originalSender.Valid && originalSender.String != "" {
+		src.SenderID = originalSender.String
+	}
+	// The poll itself stays with the original message, so a forwarded poll is just its question.
+	if src.Type == MessageTypePoll {
+		src.Type = MessageTypeText
+	}
+	// Likewise a forwarded live location is where the original was last seen.
+	if err := snapshotLiveLocation(q, &src); err != nil {
+		return src, err
+	}
+	return src, nil
+}
+
+// insertForward stores a copy of src in the conversation and returns its ID.
+func insertForward(q dbtx, src forwardSource, conversationID, senderID string, now time.Time) (string, error) {
+	newMessageID, err := GenerateNewID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate new message ID: %w", err)
+	}
+	expiresAt, err := messageExpiry(q, conversationID, now)
+	if err != nil {
+		return "", err
+	}
+	_, err = q.Exec(
+		`INSERT INTO messages (id, conversation_id, sender_id, type, content, payload, entities, reply_to, sent_at, expires_at,
+			forwarded_from, forwarded_from_sender, forward_count) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		newMessageID, conversationID, senderID, src.Type, src.Content, src.Payload, src.Entities, nil, now.Format(time.RFC3339), expiresAt,
+		src.ID, src.SenderID, src.ForwardCount+1)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert forwarded message: %w", err)
+	}
+	// The copy shares the link previews of the original.
+	_, err = q.Exec("INSERT INTO message_links (message_id, url, position) SELECT ?, url, position FROM message_links WHERE message_id = ?",
+		newMessageID, src.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy links: %w", err)
+	}
+	return newMessageID, nil
+}
+
+// privateConversationID returns the ID of the private conversation between two users, or "" if there is none.
+func privateConversationID(q dbtx, userID, otherID string) (string, error) {
+	var conversationID string
+	err := q.QueryRow(`
+		SELECT c.id FROM conversations c
+		JOIN group_members a ON a.group_id = c.id AND a.user_id = ?
+		JOIN group_members b ON b.group_id = c.id AND b.user_id = ?
+		WHERE c.is_group = 0
+		LIMIT 1`, userID, otherID).Scan(&conversationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to look up private conversation: %w", err)
+	}
+	return conversationID, nil
+}
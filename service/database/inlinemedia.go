@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// InlineImage is a message whose content is a base64 data:image URL, the way images were sent before uploads.
+type InlineImage struct {
+	RowID     int64 // Position of the message, to resume a scan after it
+	MessageID string
+	SenderID  string
+	Content   string
+}
+
+// ListInlineImages returns up to limit messages with an inline image, in storage order, starting after the message
+// at afterRowID. Messages move out of the list once ReplaceInlineImage rewrote them.
+func (db *appdbimpl) ListInlineImages(afterRowID int64, limit int) ([]InlineImage, error) {
+	rows, err := db.db.Query(`SELECT rowid, id, sender_id, content FROM messages
+		WHERE rowid > ? AND content LIKE 'data:image/%' ORDER BY rowid LIMIT ?`, afterRowID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inline images: %w", err)
+	}
+	defer rows.Close()
+
+	var images []InlineImage
+	for rows.Next() {
+		var img InlineImage
+		if err := rows.Scan(&img.RowID, &img.MessageID, &img.SenderID, &img.Content); err != nil {
+			return nil, fmt.Errorf("failed to scan inline image: %w", err)
+		}
+		images = append(images, img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return images, nil
+}
+
+// AttachmentURLExists reports whether an attachment is stored at url.
+func (db *appdbimpl) AttachmentURLExists(url string) (bool, error) {
+	var exists bool
+	err := db.db.QueryRow("SELECT EXISTS (SELECT 1 FROM attachments WHERE url = ?)", url).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up attachment: %w", err)
+	}
+	return exists, nil
+}
+
+// ReplaceInlineImage turns a message with an inline image into an image message pointing to a stored file, described
+// by a. Identical images share one attachment, recorded the first time with a.UploaderID. The message is only
+// rewritten if its content is still img.Content, so it reports false for messages deleted or changed meanwhile.
+func (db *appdbimpl) ReplaceInlineImage(img InlineImage, a Attachment, width, height int) (bool, error) {
+	content := MessageContent{Type: MessageTypeImage}
+	if err := content.encodePayload(ImagePayload{URL: a.URL, MimeType: a.MimeType, Width: width, Height: height}); err != nil {
+		return false, err
+	}
+	if err := content.Normalize(); err != nil {
+		return false, err
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", err)
+		}
+	}()
+
+	a.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err = tx.Exec(`INSERT INTO attachments (id, uploader_id, kind, url, name, mime_type, size, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (url) DO NOTHING`,
+		a.ID, a.UploaderID, AttachmentKindImage, a.URL, a.Name, a.MimeType, a.Size, a.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to create attachment: %w", err)
+	}
+	res, err := tx.Exec("UPDATE messages SET type = ?, content = ?, payload = ? WHERE id = ? AND content = ?",
+		content.Type, content.Body, nullablePayload(content.Payload), img.MessageID, img.Content)
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrite message: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrite message: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit message: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+	"github.com/donnim1/WASAText/service/markup"
+)
+
+// maxLinksPerMessage is the maximum number of URLs of a message that get a preview.
+const maxLinksPerMessage = 3
+
+// linkPreviewTTL is how long a fetched preview is reused before the URL is fetched again.
+const linkPreviewTTL = 7 * 24 * time.Hour
+
+// LinkPreview is the preview of a URL found in a message.
+type LinkPreview struct {
+	URL         string `json:"url"` // The URL as written in the message
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+}
+
+var messageURL = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// extractURLs returns the distinct http and https URLs in text, in order of appearance, without trailing
+// punctuation.
+func extractURLs(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range messageURL.FindAllString(text, -1) {
+		u = strings.TrimRight(u, ".,;:!?)]}")
+		if len(u) <= len("https://") || seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+		if len(urls) == maxLinksPerMessage {
+			break
+		}
+	}
+	return urls
+}
+
+// linkText returns the text searched for links to preview: the body followed by the targets of formatted links,
+// which may not appear in the body themselves.
+func linkText(content MessageContent) string {
+	text := content.Body
+	for _, e := range content.Entities {
+		if e.Type == markup.Link {
+			text += " " + e.URL
+		}
+	}
+	return text
+}
+
+// queueLinkPreviews records the URLs in a message and queues those without a fresh preview for the unfurl worker.
+func queueLinkPreviews(q dbtx, messageID, text string, now time.Time) error {
+	currentTime := now.UTC().Format(time.RFC3339)
+	stale := now.Add(-linkPreviewTTL).UTC().Format(time.RFC3339)
+	for i, u := range extractURLs(text) {
+		if _, err := q.Exec("INSERT OR IGNORE INTO message_links (message_id, url, position) VALUES (?, ?, ?)",
+			messageID, u, i); err != nil {
+			return fmt.Errorf("failed to record link: %w", err)
+		}
+		_, err := q.Exec(`INSERT INTO link_previews (url, status, created_at) VALUES (?, 'pending', ?)
+			ON CONFLICT (url) DO UPDATE SET status = 'pending'
+			WHERE link_previews.status != 'pending' AND link_previews.fetched_at < ?`,
+			u, currentTime, stale)
+		if err != nil {
+			return fmt.Errorf("failed to queue link preview: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetPendingLinkPreviews returns up to limit URLs waiting to be fetched, oldest first.
+func (db *appdbimpl) GetPendingLinkPreviews(limit int) ([]string, error) {
+	rows, err := db.db.Query("SELECT url FROM link_previews WHERE status = 'pending' ORDER BY created_at ASC LIMIT ?", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending link previews: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, fmt.Errorf("failed to scan link preview: %w", err)
+		}
+		urls = append(urls, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return urls, nil
+}
+
+// SaveLinkPreview stores the result of fetching a URL: the preview, or failure if it could not be fetched.
+func (db *appdbimpl) SaveLinkPreview(preview LinkPreview, failure string) error {
+	status := "ok"
+	if failure != "" {
+		status = "failed"
+		preview = LinkPreview{URL: preview.URL}
+	}
+	currentTime := globaltime.Now().UTC().Format(time.RFC3339)
+	_, err := db.db.Exec(`UPDATE link_previews
+		SET status = ?, title = ?, description = ?, image_url = ?, site_name = ?, error = ?, fetched_at = ?
+		WHERE url = ?`,
+		status, preview.Title, preview.Description, preview.ImageURL, preview.SiteName, failure, currentTime, preview.URL)
+	if err != nil {
+		return fmt.Errorf("failed to save link preview: %w", err)
+	}
+	return nil
+}
+
+// attachLinkPreviews sets the fetched previews of each message, in the order their URLs appear.
+func (db *appdbimpl) attachLinkPreviews(messages []Message) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messages)), ",")
+	args := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		args = append(args, msg.ID)
+	}
+
+	rows, err := db.db.Query(`
+		SELECT ml.message_id, lp.url, lp.title, lp.description, lp.image_url, lp.site_name
+		FROM message_links ml
+		JOIN link_previews lp ON lp.url = ml.url
+		WHERE lp.status = 'ok' AND ml.message_id IN (`+placeholders+`)
+		ORDER BY ml.position ASC`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query link previews: %w", err)
+	}
+	defer rows.Close()
+
+	previews := make(map[string][]LinkPreview)
+	for rows.Next() {
+		var messageID string
+		var p LinkPreview
+		var title, description, imageURL, siteName sql.NullString
+		if err := rows.Scan(&messageID, &p.URL, &title, &description, &imageURL, &siteName); err != nil {
+			return fmt.Errorf("failed to scan link preview: %w", err)
+		}
+		p.Title, p.Description, p.ImageURL, p.SiteName = title.String, description.String, imageURL.String, siteName.String
+		previews[messageID] = append(previews[messageID], p)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("link preview rows iteration error: %w", err)
+	}
+
+	for i := range messages {
+		messages[i].LinkPreviews = previews[messages[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "none", text: "no links here", want: nil},
+		{name: "one", text: "see https://example.com/a?b=c#d", want: []string{"https://example.com/a?b=c#d"}},
+		{name: "trailing punctuation", text: "(look at http://example.com/x). Or https://example.org!",
+			want: []string{"http://example.com/x", "https://example.org"}},
+		{name: "duplicates", text: "https://example.com https://example.com", want: []string{"https://example.com"}},
+		{name: "scheme only", text: "https:// and http://", want: nil},
+		{name: "other schemes", text: "ftp://example.com mailto:a@example.com", want: nil},
+		{name: "quoted", text: `<a href="https://example.com/q">`, want: []string{"https://example.com/q"}},
+		{name: "at most maxLinksPerMessage", text: "https://a.example https://b.example https://c.example https://d.example",
+			want: []string{"https://a.example", "https://b.example", "https://c.example"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractURLs(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractURLs(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+// Bounds of LocationPayload.LivePeriod, in seconds.
+const (
+	minLivePeriod = 60
+	maxLivePeriod = 8 * 60 * 60
+)
+
+// ErrLiveLocationNotFound is returned when a message is not a live location, or the user may not update it.
+var ErrLiveLocationNotFound = errors.New("live location not found")
+
+// ErrLiveLocationEnded is returned when updating a live location after it was stopped or expired.
+var ErrLiveLocationEnded = errors.New("live location has ended")
+
+// LiveLocation is the current position of a live location message. The message payload keeps the starting point.
+type LiveLocation struct {
+	MessageID string  `json:"messageId"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy,omitempty"` // Meters
+	UpdatedAt string  `json:"updatedAt"`
+	ExpiresAt string  `json:"expiresAt"`
+	EndedAt   string  `json:"endedAt,omitempty"` // Set once stopped by the sender or expired
+}
+
+// Active reports whether the sender can still update the location.
+func (l LiveLocation) Active() bool {
+	return l.EndedAt == ""
+}
+
+// LocationUpdate is a new position sent by the sender of a live location.
+type LocationUpdate struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Accuracy  float64  `json:"accuracy,omitempty"`
+}
+
+// validate checks the coordinates like MessageContent.Normalize does for location payloads.
+func (u LocationUpdate) validate() error {
+	if u.Latitude == nil || u.Longitude == nil ||
+		*u.Latitude < -90 || *u.Latitude > 90 || *u.Longitude < -180 || *u.Longitude > 180 {
+		return fmt.Errorf("%w: location needs a valid latitude and longitude", ErrInvalidContent)
+	}
+	if u.Accuracy < 0 {
+		return fmt.Errorf("%w: invalid accuracy", ErrInvalidContent)
+	}
+	return nil
+}
+
+// startLiveLocation opens the live session of a location message whose payload asks for one. content must have been
+// normalized.
+func startLiveLocation(q dbtx, messageID string, content MessageContent, now time.Time) error {
+	if content.Type != MessageTypeLocation {
+		return nil
+	}
+	var p LocationPayload
+	if err := json.Unmarshal(content.Payload, &p); err != nil {
+		return fmt.Errorf("failed to decode location payload: %w", err)
+	}
+	if p.LivePeriod == 0 {
+		return nil
+	}
+	_, err := q.Exec(`INSERT INTO live_locations (message_id, latitude, longitude, accuracy, updated_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		messageID, *p.Latitude, *p.Longitude, p.Accuracy, now.UTC().Format(time.RFC3339),
+		now.Add(time.Duration(p.LivePeriod)*time.Second).UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to start live location: %w", err)
+	}
+	return nil
+}
+
+// snapshotLiveLocation turns a live location being forwarded into a static location at its current position: only
+// the original message has a live session its sender can move. Other messages are left unchanged.
+func snapshotLiveLocation(q dbtx, src *forwardSource) error {
+	if src.Type != MessageTypeLocation || !src.Payload.Valid {
+		return nil
+	}
+	var p LocationPayload
+	if err := json.Unmarshal([]byte(src.Payload.String), &p); err != nil {
+		return fmt.Errorf("failed to decode location payload: %w", err)
+	}
+	if p.LivePeriod == 0 {
+		return nil
+	}
+	var lat, lon, accuracy float64
+	err := q.QueryRow("SELECT latitude, longitude, accuracy FROM live_locations WHERE message_id = ?", src.ID).
+		Scan(&lat, &lon, &accuracy)
+	if err == nil {
+		p.Latitude, p.Longitude, p.Accuracy = &lat, &lon, accuracy
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get live location: %w", err)
+	}
+	p.LivePeriod = 0
+	b, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode location payload: %w", err)
+	}
+	src.Payload = sql.NullString{String: string(b), Valid: true}
+	// The default caption of a live location would be wrong on the copy.
+	if src.Content == "Live location"+prefixed(": ", p.Label) {
+		src.Content = "Location" + prefixed(": ", p.Label)
+	}
+	return nil
+}
+
+// UpdateLiveLocation moves an active live location. Only the sender of the message may update it.
+func (db *appdbimpl) UpdateLiveLocation(messageID, userID string, update LocationUpdate) (LiveLocation, error) {
+	if err := update.validate(); err != nil {
+		return LiveLocation{}, err
+	}
+	loc, senderID, err := db.getLiveLocation(messageID)
+	if err != nil {
+		return LiveLocation{}, err
+	}
+	if senderID != userID {
+		return LiveLocation{}, ErrLiveLocationNotFound
+	}
+
+	now := globaltime.Now().UTC().Format(time.RFC3339)
+	res, err := db.db.Exec(`UPDATE live_locations SET latitude = ?, longitude = ?, accuracy = ?, updated_at = ?
+		WHERE message_id = ? AND ended_at IS NULL AND expires_at > ?`,
+		*update.Latitude, *update.Longitude, update.Accuracy, now, messageID, now)
+	if err != nil {
+		return LiveLocation{}, fmt.Errorf("failed to update live location: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return LiveLocation{}, fmt.Errorf("failed to update live location: %w", err)
+	}
+	if affected == 0 {
+		return LiveLocation{}, ErrLiveLocationEnded
+	}
+	loc.Latitude, loc.Longitude, loc.Accuracy, loc.UpdatedAt = *update.Latitude, *update.Longitude, update.Accuracy, now
+	return loc, nil
+}
+
+// StopLiveLocation ends a live location before it expires. Stopping an ended location is a no-op.
+func (db *appdbimpl) StopLiveLocation(messageID, userID string) (LiveLocation, error) {
+	loc, senderID, err := db.getLiveLocation(messageID)
+	if err != nil {
+		return LiveLocation{}, err
+	}
+	if senderID != userID {
+		return LiveLocation{}, ErrLiveLocationNotFound
+	}
+	if !loc.Active() {
+		return loc, nil
+	}
+
+	now := globaltime.Now().UTC().Format(time.RFC3339)
+	if _, err := db.db.Exec("UPDATE live_locations SET ended_at = ? WHERE message_id = ? AND ended_at IS NULL",
+		now, messageID); err != nil {
+		return LiveLocation{}, fmt.Errorf("failed to stop live location: %w", err)
+	}
+	loc.EndedAt = now
+	return loc, nil
+}
+
+// GetLiveLocation returns the current position of a live location in a conversation the user is a member of.
+func (db *appdbimpl) GetLiveLocation(messageID, userID string) (LiveLocation, error) {
+	conversationID, err := db.messageConversationID(messageID)
+	if err != nil {
+		return LiveLocation{}, err
+	}
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return LiveLocation{}, err
+	}
+	loc, _, err := db.getLiveLocation(messageID)
+	return loc, err
+}
+
+// EndExpiredLiveLocations ends the live locations whose period is over and returns their message IDs.
+func (db *appdbimpl) EndExpiredLiveLocations(now time.Time) ([]string, error) {
+	current := now.UTC().Format(time.RFC3339)
+	rows, err := db.db.Query("SELECT message_id FROM live_locations WHERE ended_at IS NULL AND expires_at <= ?", current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired live locations: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan expired live location: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	for _, id := range ids {
+		// A session ends at its expiry time, even if the sweep runs later.
+		if _, err := db.db.Exec("UPDATE live_locations SET ended_at = expires_at WHERE message_id = ? AND ended_at IS NULL",
+			id); err != nil {
+			return nil, fmt.Errorf("failed to end live location: %w", err)
+		}
+	}
+	return ids, nil
+}
+
+// getLiveLocation loads a live location and the sender of its message.
+func (db *appdbimpl) getLiveLocation(messageID string) (LiveLocation, string, error) {
+	loc := LiveLocation{MessageID: messageID}
+	var senderID string
+	var endedAt sql.NullString
+	err := db.db.QueryRow(`SELECT m.sender_id, l.latitude, l.longitude, l.accuracy, l.updated_at, l.expires_at, l.ended_at
+		FROM live_locations l JOIN messages m ON m.id = l.message_id
+		WHERE l.message_id = ?`, messageID).
+		Scan(&senderID, &loc.Latitude, &loc.Longitude, &loc.Accuracy, &loc.UpdatedAt, &loc.ExpiresAt, &endedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LiveLocation{}, "", ErrLiveLocationNotFound
+	} else if err != nil {
+		return LiveLocation{}, "", fmt.Errorf("failed to get live location: %w", err)
+	}
+	loc.EndedAt = endedAt.String
+	return loc, senderID, nil
+}
+
+// attachLiveLocations sets the current position of each live location message.
+func (db *appdbimpl) attachLiveLocations(messages []Message) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messages)), ",")
+	args := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		args = append(args, msg.ID)
+	}
+
+	rows, err := db.db.Query(`SELECT message_id, latitude, longitude, accuracy, updated_at, expires_at, ended_at
+		FROM live_locations WHERE message_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query live locations: %w", err)
+	}
+	defer rows.Close()
+
+	locations := make(map[string]*LiveLocation)
+	for rows.Next() {
+		var loc LiveLocation
+		var endedAt sql.NullString
+		if err := rows.Scan(&loc.MessageID, &loc.Latitude, &loc.Longitude, &loc.Accuracy, &loc.UpdatedAt, &loc.ExpiresAt,
+			&endedAt); err != nil {
+			return fmt.Errorf("failed to scan live location: %w", err)
+		}
+		loc.EndedAt = endedAt.String
+		locations[loc.MessageID] = &loc
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("live location rows iteration error: %w", err)
+	}
+
+	for i := range messages {
+		messages[i].LiveLocation = locations[messages[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// mediaReferenceQueries select the columns that may refer to stored files, each with the function extracting the
+// URLs from a value: photos hold a URL, payloads are JSON objects with a url field and draft attachments are JSON
+// lists of such payloads.
+var mediaReferenceQueries = []struct {
+	query string
+	add   func(refs map[string]bool, value string)
+}{
+	{"SELECT photo_url FROM users WHERE photo_url IS NOT NULL AND photo_url != ''", addURL},
+	{"SELECT group_photo FROM conversations WHERE group_photo IS NOT NULL AND group_photo != ''", addURL},
+	{"SELECT payload FROM messages WHERE payload IS NOT NULL", addPayloadURL},
+	{"SELECT payload FROM scheduled_messages WHERE payload IS NOT NULL", addPayloadURL},
+	{"SELECT attachments FROM drafts WHERE attachments != '[]'", addDraftURLs},
+	{"SELECT url FROM stickers", addURL},
+}
+
+// ReferencedMediaURLs returns the URLs of the stored files that users, groups, messages, scheduled messages, drafts
+// and sticker packs refer to. Attachments that were never sent are not references: their files are kept only for the grace
+// period of the collector.
+func (db *appdbimpl) ReferencedMediaURLs() (map[string]bool, error) {
+	return referencedMediaURLs(db.db)
+}
+
+func referencedMediaURLs(q dbtx) (map[string]bool, error) {
+	refs := make(map[string]bool)
+	for _, mq := range mediaReferenceQueries {
+		rows, err := q.Query(mq.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query media references: %w", err)
+		}
+		for rows.Next() {
+			var value string
+			if err := rows.Scan(&value); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan media reference: %w", err)
+			}
+			mq.add(refs, value)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("rows iteration error: %w", err)
+		}
+	}
+	return refs, nil
+}
+
+// addURL adds a photo URL.
+func addURL(refs map[string]bool, url string) {
+	refs[strings.TrimSpace(url)] = true
+}
+
+// addPayloadURL adds the url of a message payload, if it has one.
+func addPayloadURL(refs map[string]bool, payload string) {
+	var p struct {
+		URL string `json:"url"`
+	}
+	if json.Unmarshal([]byte(payload), &p) != nil || p.URL == "" {
+		return
+	}
+	refs[p.URL] = true
+}
+
+// addDraftURLs adds the urls of the attachments of a draft.
+func addDraftURLs(refs map[string]bool, attachments string) {
+	var list []DraftAttachment
+	if err := json.Unmarshal([]byte(attachments), &list); err != nil {
+		log.Printf("failed to decode draft attachments: %v", err)
+		return
+	}
+	for _, a := range list {
+		addPayloadURL(refs, string(a.Payload))
+	}
+}
+
+// ReleaseMedia calls remove for each of urls that nothing refers to any more, and forgets the attachments stored
+// there. The references are read again in a transaction holding the database write lock, so that none can be added
+// between the check and the removal. It returns the URLs removed; a failed remove stops the release, keeping what was
+// removed before.
+func (db *appdbimpl) ReleaseMedia(urls []string, remove func(url string) error) ([]string, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("rollback failed: %v", err)
+		}
+	}()
+
+	// A first write takes the write lock: the messages, drafts and photos sent from now on wait for the commit.
+	if _, err := tx.Exec("DELETE FROM attachments WHERE 0"); err != nil {
+		return nil, fmt.Errorf("failed to lock database: %w", err)
+	}
+	refs, err := referencedMediaURLs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var removeErr error
+	for _, url := range urls {
+		if refs[url] {
+			continue
+		}
+		if removeErr = remove(url); removeErr != nil {
+			break
+		}
+		if _, err := tx.Exec("DELETE FROM attachments WHERE url = ?", url); err != nil {
+			return nil, fmt.Errorf("failed to delete attachment: %w", err)
+		}
+		removed = append(removed, url)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return removed, removeErr
+}
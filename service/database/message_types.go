@@ -0,0 +1,413 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/donnim1/WASAText/service/markup"
+	"github.com/donnim1/WASAText/service/vcard"
+)
+
+// Message types stored in messages.type.
+const (
+	MessageTypeText     = "text"
+	MessageTypeImage    = "image"
+	MessageTypeFile     = "file"
+	MessageTypeAudio    = "audio"
+	MessageTypeLocation = "location"
+	MessageTypeContact  = "contact"
+	MessageTypePoll     = "poll"
+	MessageTypeSticker  = "sticker"
+	MessageTypeSystem   = "system"
+)
+
+// MaxBodyLength is the maximum length of a text message body.
+const MaxBodyLength = 5000
+
+// ErrInvalidContent is returned when a message's content does not match its type.
+var ErrInvalidContent = errors.New("invalid message content")
+
+// MessageContent is what a message carries: its type, the plain-text body stored in messages.content, and the
+// type-specific payload. The body is what previews and clients unaware of the type display. Text messages may carry
+// formatting entities over the body, see package markup.
+type MessageContent struct {
+	Type     string
+	Body     string
+	Payload  json.RawMessage
+	Entities []markup.Entity
+	// AttachmentID refers to an uploaded file, from which SendMessage derives the type and payload.
+	AttachmentID string
+}
+
+// ImagePayload is the payload of an image message. Legacy images carry no URL; their body is a data:image URL.
+type ImagePayload struct {
+	URL      string `json:"url,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+}
+
+// FilePayload is the payload of a file message.
+type FilePayload struct {
+	URL      string `json:"url"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// AudioPayload is the payload of an audio message.
+type AudioPayload struct {
+	URL        string `json:"url"`
+	MimeType   string `json:"mimeType,omitempty"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	// Waveform holds peak amplitudes from 0 to 100 across the recording. Uploaded audio gets it from the server.
+	Waveform []int `json:"waveform,omitempty"`
+}
+
+// LocationPayload is the payload of a location message.
+type LocationPayload struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Accuracy  float64  `json:"accuracy,omitempty"` // Meters
+	Label     string   `json:"label,omitempty"`
+	// LivePeriod makes the location live: the sender can move it for this many seconds, see UpdateLiveLocation.
+	LivePeriod int `json:"livePeriod,omitempty"`
+}
+
+// ContactPayload is the payload of a contact message, referring to a WASAText user or carrying contact details,
+// possibly as a vCard. Name, Phone and Email are filled in from the vCard when left empty.
+type ContactPayload struct {
+	UserID string `json:"userId,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Phone  string `json:"phone,omitempty"`
+	Email  string `json:"email,omitempty"`
+	VCard  string `json:"vcard,omitempty"` // vCard 3.0 or 4.0, rewritten with CRLF line endings
+}
+
+// StickerPayload is the payload of a sticker message. Clients send the pack and sticker IDs; the server fills in the
+// rest from the sender's installed packs.
+type StickerPayload struct {
+	PackID    string `json:"packId"`
+	StickerID string `json:"stickerId"`
+	URL       string `json:"url,omitempty"`
+	MimeType  string `json:"mimeType,omitempty"`
+	Emoji     string `json:"emoji,omitempty"` // First emoji tag of the sticker
+}
+
+// Normalize validates the content against its type and canonicalizes it: the payload is re-encoded without unknown
+// fields, and an empty body is replaced by a short description of the message. Errors wrap ErrInvalidContent.
+func (c *MessageContent) Normalize() error {
+	if c.Type == "" {
+		c.Type = MessageTypeText
+	}
+	// Entity offsets refer to the body as is, which markup.Parse already returns trimmed.
+	if len(c.Entities) == 0 {
+		c.Body = strings.TrimSpace(c.Body)
+	} else if c.Type != MessageTypeText {
+		return fmt.Errorf("%w: only text messages can be formatted", ErrInvalidContent)
+	}
+	if len(c.Body) > MaxBodyLength {
+		return fmt.Errorf("%w: body longer than %d characters", ErrInvalidContent, MaxBodyLength)
+	}
+	// Only messages stored before uploads existed hold inline images; classifyMessageTypes has typed those already.
+	if isDataImageURL(c.Body) {
+		return fmt.Errorf("%w: inline images must be uploaded", ErrInvalidContent)
+	}
+
+	switch c.Type {
+	case MessageTypeText, MessageTypeSystem, MessageTypePoll:
+		if len(c.Payload) > 0 && !bytes.Equal(c.Payload, []byte("null")) {
+			return fmt.Errorf("%w: %s messages take no payload", ErrInvalidContent, c.Type)
+		}
+		c.Payload = nil
+		if strings.TrimSpace(c.Body) == "" {
+			return fmt.Errorf("%w: empty %s message", ErrInvalidContent, c.Type)
+		}
+		if err := markup.Validate(c.Body, c.Entities); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+		}
+		return nil
+
+	case MessageTypeImage:
+		var p ImagePayload
+		if err := decodePayload(c.Payload, &p); err != nil {
+			return err
+		}
+		if p.URL == "" {
+			return fmt.Errorf("%w: image needs a url", ErrInvalidContent)
+		}
+		if !isMediaURL(p.URL) {
+			return fmt.Errorf("%w: image url must be https or an upload", ErrInvalidContent)
+		}
+		if p.MimeType != "" && !strings.HasPrefix(p.MimeType, "image/") {
+			return fmt.Errorf("%w: not an image type", ErrInvalidContent)
+		}
+		if p.Width < 0 || p.Height < 0 {
+			return fmt.Errorf("%w: negative image size", ErrInvalidContent)
+		}
+		if c.Body == "" {
+			c.Body = firstNonEmpty(p.Caption, "Photo")
+		}
+		return c.encodePayload(p)
+
+	case MessageTypeFile:
+		var p FilePayload
+		if err := decodePayload(c.Payload, &p); err != nil {
+			return err
+		}
+		if !isMediaURL(p.URL) || strings.TrimSpace(p.Name) == "" {
+			return fmt.Errorf("%w: file needs a url and a name", ErrInvalidContent)
+		}
+		if p.Size < 0 {
+			return fmt.Errorf("%w: negative file size", ErrInvalidContent)
+		}
+		if c.Body == "" {
+			c.Body = "File: " + p.Name
+		}
+		return c.encodePayload(p)
+
+	case MessageTypeAudio:
+		var p AudioPayload
+		if err := decodePayload(c.Payload, &p); err != nil {
+			return err
+		}
+		if !isMediaURL(p.URL) {
+			return fmt.Errorf("%w: audio needs a url", ErrInvalidContent)
+		}
+		if p.MimeType != "" && !strings.HasPrefix(p.MimeType, "audio/") {
+			return fmt.Errorf("%w: not an audio type", ErrInvalidContent)
+		}
+		if p.DurationMs < 0 || p.DurationMs > MaxAudioDuration.Milliseconds() {
+			return fmt.Errorf("%w: audio must be at most %v long", ErrInvalidContent, MaxAudioDuration)
+		}
+		if len(p.Waveform) > maxWaveformBars {
+			return fmt.Errorf("%w: waveform longer than %d bars", ErrInvalidContent, maxWaveformBars)
+		}
+		for _, v := range p.Waveform {
+			if v < 0 || v > 100 {
+				return fmt.Errorf("%w: waveform values must be between 0 and 100", ErrInvalidContent)
+			}
+		}
+		if c.Body == "" {
+			c.Body = "Audio"
+		}
+		return c.encodePayload(p)
+
+	case MessageTypeLocation:
+		var p LocationPayload
+		if err := decodePayload(c.Payload, &p); err != nil {
+			return err
+		}
+		if p.Latitude == nil || p.Longitude == nil ||
+			*p.Latitude < -90 || *p.Latitude > 90 || *p.Longitude < -180 || *p.Longitude > 180 {
+			return fmt.Errorf("%w: location needs a valid latitude and longitude", ErrInvalidContent)
+		}
+		if p.Accuracy < 0 || len(p.Label) > 100 {
+			return fmt.Errorf("%w: invalid accuracy or label", ErrInvalidContent)
+		}
+		if p.LivePeriod != 0 && (p.LivePeriod < minLivePeriod || p.LivePeriod > maxLivePeriod) {
+			return fmt.Errorf("%w: live period must be between %d and %d seconds", ErrInvalidContent, minLivePeriod, maxLivePeriod)
+		}
+		if c.Body == "" && p.LivePeriod != 0 {
+			c.Body = "Live location" + prefixed(": ", p.Label)
+		} else if c.Body == "" {
+			c.Body = "Location" + prefixed(": ", p.Label)
+		}
+		return c.encodePayload(p)
+
+	case MessageTypeContact:
+		var p ContactPayload
+		if err := decodePayload(c.Payload, &p); err != nil {
+			return err
+		}
+		if p.VCard != "" {
+			card, err := vcard.Parse(p.VCard)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+			}
+			p.VCard = card.String()
+			p.Name = firstNonEmpty(p.Name, card.Text("FN"))
+			p.Phone = firstNonEmpty(p.Phone, card.Text("TEL"))
+			p.Email = firstNonEmpty(p.Email, card.Text("EMAIL"))
+		}
+		if p.UserID == "" && strings.TrimSpace(p.Name) == "" {
+			return fmt.Errorf("%w: contact needs a user ID or a name", ErrInvalidContent)
+		}
+		if len(p.Name) > 100 || len(p.Phone) > 100 || len(p.Email) > 254 {
+			return fmt.Errorf("%w: contact details too long", ErrInvalidContent)
+		}
+		if c.Body == "" {
+			c.Body = "Contact" + prefixed(": ", p.Name)
+		}
+		return c.encodePayload(p)
+
+	case MessageTypeSticker:
+		var p StickerPayload
+		if err := decodePayload(c.Payload, &p); err != nil {
+			return err
+		}
+		if p.PackID == "" || p.StickerID == "" || !isMediaURL(p.URL) {
+			return fmt.Errorf("%w: sticker needs a pack, a sticker ID and a url", ErrInvalidContent)
+		}
+		if p.MimeType != "" && !strings.HasPrefix(p.MimeType, "image/") {
+			return fmt.Errorf("%w: not an image type", ErrInvalidContent)
+		}
+		if c.Body == "" {
+			c.Body = "Sticker" + prefixed(" ", p.Emoji)
+		}
+		return c.encodePayload(p)
+	}
+	return fmt.Errorf("%w: unknown type %q", ErrInvalidContent, c.Type)
+}
+
+// encodeEntities converts formatting entities to JSON for storage, or NULL if there are none.
+func encodeEntities(entities []markup.Entity) (interface{}, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(entities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entities: %w", err)
+	}
+	return string(b), nil
+}
+
+// decodeEntities parses formatting entities stored by encodeEntities. Unreadable entities are dropped, leaving the
+// message unformatted.
+func decodeEntities(stored sql.NullString) []markup.Entity {
+	if !stored.Valid || stored.String == "" {
+		return nil
+	}
+	var entities []markup.Entity
+	if err := json.Unmarshal([]byte(stored.String), &entities); err != nil {
+		log.Printf("failed to decode message entities: %v", err)
+		return nil
+	}
+	return entities
+}
+
+// decodePayload strictly decodes a payload into v. A missing payload decodes as an empty object, leaving required
+// fields to the type's checks.
+func decodePayload(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidContent, err)
+	}
+	return nil
+}
+
+// encodePayload stores the canonical encoding of v as the payload.
+func (c *MessageContent) encodePayload(v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	c.Payload = payload
+	return nil
+}
+
+// isDataImageURL reports whether s is an inline base64 image, the way images were stored before message types.
+func isDataImageURL(s string) bool {
+	return strings.HasPrefix(s, "data:image/")
+}
+
+// isMediaURL reports whether s points to media clients may load: an HTTPS URL or a file in the uploads directory.
+func isMediaURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "/uploads/")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func prefixed(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + s
+}
+
+// forwardedImageSrc matches the HTML that ForwardMessage used to store for forwarded images.
+var forwardedImageSrc = regexp.MustCompile(`^<div class="forward-caption">.*?</div><img src="(data:image/[^"]+)"`)
+
+// classifyMessageTypes sets the type of messages stored before messages.type existed. Inline images become image
+// messages (forwarded ones lose the HTML wrapper), poll questions become poll messages, and the rest stay text.
+func classifyMessageTypes(db *sql.DB) error {
+	if _, err := db.Exec("UPDATE messages SET type = ? WHERE id IN (SELECT message_id FROM polls)", MessageTypePoll); err != nil {
+		return fmt.Errorf("failed to classify polls: %w", err)
+	}
+
+	// Collect first: SQLite can't update rows while a read on another connection is open.
+	rows, err := db.Query(`SELECT id, content FROM messages WHERE content LIKE 'data:image/%' OR content LIKE '<div class="forward-caption">%'`)
+	if err != nil {
+		return fmt.Errorf("failed to query inline images: %w", err)
+	}
+	images := make(map[string]string)
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan message: %w", err)
+		}
+		if m := forwardedImageSrc.FindStringSubmatch(content); m != nil {
+			content = m[1]
+		}
+		if isDataImageURL(content) {
+			images[id] = content
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("rows iteration error: %w", err)
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", rbErr)
+		}
+	}()
+	for id, dataURL := range images {
+		payload, err := json.Marshal(ImagePayload{MimeType: dataURLMimeType(dataURL)})
+		if err != nil {
+			return fmt.Errorf("failed to encode payload: %w", err)
+		}
+		if _, err := tx.Exec("UPDATE messages SET type = ?, content = ?, payload = ? WHERE id = ?",
+			MessageTypeImage, dataURL, string(payload), id); err != nil {
+			return fmt.Errorf("failed to classify image: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
+
+// dataURLMimeType returns the media type of a data URL such as "data:image/png;base64,...".
+func dataURLMimeType(dataURL string) string {
+	rest := strings.TrimPrefix(dataURL, "data:")
+	if i := strings.IndexAny(rest, ";,"); i >= 0 {
+		return rest[:i]
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/donnim1/WASAText/service/markup"
+)
+
+func TestMessageContentNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		content MessageContent
+		typ     string
+		body    string
+		payload string // Canonical payload, "" for none
+		invalid bool
+	}{
+		{name: "text defaults the type", content: MessageContent{Body: "  hi  "}, typ: MessageTypeText, body: "hi"},
+		{name: "text with null payload", content: MessageContent{Type: MessageTypeText, Body: "hi", Payload: json.RawMessage("null")},
+			typ: MessageTypeText, body: "hi"},
+		{name: "text with payload", content: MessageContent{Body: "hi", Payload: json.RawMessage(`{"url":"x"}`)}, invalid: true},
+		{name: "empty text", content: MessageContent{Body: "   "}, invalid: true},
+		{name: "text too long", content: MessageContent{Body: strings.Repeat("a", MaxBodyLength+1)}, invalid: true},
+		{name: "formatted text keeps spaces", content: MessageContent{Body: " a b", Entities: []markup.Entity{{Type: markup.Bold, Offset: 1, Length: 1}}},
+			typ: MessageTypeText, body: " a b"},
+		{name: "entities out of range", content: MessageContent{Body: "ab", Entities: []markup.Entity{{Type: markup.Bold, Offset: 1, Length: 2}}},
+			invalid: true},
+		{name: "formatted image", content: MessageContent{Type: MessageTypeImage, Body: "a", Payload: json.RawMessage(`{"url":"https://example.com/a.png"}`),
+			Entities: []markup.Entity{{Type: markup.Bold, Offset: 0, Length: 1}}}, invalid: true},
+
+		{name: "image", content: MessageContent{Type: MessageTypeImage, Payload: json.RawMessage(`{"caption":"Beach","url":"/uploads/a.png","width":2}`)},
+			typ: MessageTypeImage, body: "Beach", payload: `{"url":"/uploads/a.png","width":2,"caption":"Beach"}`},
+		{name: "image without caption", content: MessageContent{Type: MessageTypeImage, Payload: json.RawMessage(`{"url":"https://example.com/a.png"}`)},
+			typ: MessageTypeImage, body: "Photo", payload: `{"url":"https://example.com/a.png"}`},
+		{name: "image without url", content: MessageContent{Type: MessageTypeImage, Payload: json.RawMessage(`{"caption":"Beach"}`)}, invalid: true},
+		{name: "inline data URL image", content: MessageContent{Type: MessageTypeImage, Body: "data:image/png;base64,AAAA"}, invalid: true},
+		{name: "long inline data URL image", content: MessageContent{Type: MessageTypeImage, Body: "data:image/png;base64," + strings.Repeat("A", MaxBodyLength)},
+			invalid: true},
+		{name: "inline data URL as text", content: MessageContent{Body: "data:image/png;base64,AAAA"}, invalid: true},
+		{name: "image over http", content: MessageContent{Type: MessageTypeImage, Payload: json.RawMessage(`{"url":"http://example.com/a.png"}`)}, invalid: true},
+		{name: "image of another type", content: MessageContent{Type: MessageTypeImage, Payload: json.RawMessage(`{"url":"/uploads/a","mimeType":"text/html"}`)},
+			invalid: true},
+		{name: "image with unknown field", content: MessageContent{Type: MessageTypeImage, Payload: json.RawMessage(`{"url":"/uploads/a.png","onload":"x"}`)},
+			invalid: true},
+
+		{name: "file", content: MessageContent{Type: MessageTypeFile, Payload: json.RawMessage(`{"url":"/uploads/r.pdf","name":"r.pdf","size":10}`)},
+			typ: MessageTypeFile, body: "File: r.pdf", payload: `{"url":"/uploads/r.pdf","name":"r.pdf","size":10}`},
+		{name: "file without name", content: MessageContent{Type: MessageTypeFile, Payload: json.RawMessage(`{"url":"/uploads/r.pdf","name":" "}`)}, invalid: true},
+		{name: "file with negative size", content: MessageContent{Type: MessageTypeFile, Payload: json.RawMessage(`{"url":"/uploads/r","name":"r","size":-1}`)},
+			invalid: true},
+
+		{name: "audio", content: MessageContent{Type: MessageTypeAudio, Payload: json.RawMessage(`{"url":"/uploads/v.ogg","durationMs":1500,"waveform":[0,100]}`)},
+			typ: MessageTypeAudio, body: "Audio", payload: `{"url":"/uploads/v.ogg","durationMs":1500,"waveform":[0,100]}`},
+		{name: "audio too long", content: MessageContent{Type: MessageTypeAudio,
+			Payload: json.RawMessage(`{"url":"/uploads/v.ogg","durationMs":` + strings.Repeat("9", 12) + `}`)}, invalid: true},
+		{name: "audio waveform out of range", content: MessageContent{Type: MessageTypeAudio, Payload: json.RawMessage(`{"url":"/uploads/v.ogg","waveform":[101]}`)},
+			invalid: true},
+		{name: "audio of another type", content: MessageContent{Type: MessageTypeAudio, Payload: json.RawMessage(`{"url":"/uploads/v","mimeType":"video/mp4"}`)},
+			invalid: true},
+
+		{name: "location", content: MessageContent{Type: MessageTypeLocation, Payload: json.RawMessage(`{"latitude":41.9,"longitude":12.5,"label":"Rome"}`)},
+			typ: MessageTypeLocation, body: "Location: Rome", payload: `{"latitude":41.9,"longitude":12.5,"label":"Rome"}`},
+		{name: "live location", content: MessageContent{Type: MessageTypeLocation, Payload: json.RawMessage(`{"latitude":0,"longitude":0,"livePeriod":900}`)},
+			typ: MessageTypeLocation, body: "Live location", payload: `{"latitude":0,"longitude":0,"livePeriod":900}`},
+		{name: "location without coordinates", content: MessageContent{Type: MessageTypeLocation, Payload: json.RawMessage(`{"label":"Rome"}`)}, invalid: true},
+		{name: "location out of range", content: MessageContent{Type: MessageTypeLocation, Payload: json.RawMessage(`{"latitude":91,"longitude":0}`)}, invalid: true},
+		{name: "live period too short", content: MessageContent{Type: MessageTypeLocation, Payload: json.RawMessage(`{"latitude":0,"longitude":0,"livePeriod":10}`)},
+			invalid: true},
+
+		{name: "contact from vCard", content: MessageContent{Type: MessageTypeContact,
+			Payload: json.RawMessage(`{"vcard":"BEGIN:VCARD\nVERSION:4.0\nFN:Ada\nTEL:+1\nEND:VCARD"}`)},
+			typ: MessageTypeContact, body: "Contact: Ada",
+			payload: `{"name":"Ada","phone":"+1","vcard":"BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Ada\r\nTEL:+1\r\nEND:VCARD\r\n"}`},
+		{name: "contact of a user", content: MessageContent{Type: MessageTypeContact, Body: "Meet Bob", Payload: json.RawMessage(`{"userId":"u1"}`)},
+			typ: MessageTypeContact, body: "Meet Bob", payload: `{"userId":"u1"}`},
+		{name: "contact without name", content: MessageContent{Type: MessageTypeContact, Payload: json.RawMessage(`{"phone":"+1"}`)}, invalid: true},
+		{name: "contact with bad vCard", content: MessageContent{Type: MessageTypeContact, Payload: json.RawMessage(`{"vcard":"BEGIN:VCARD"}`)}, invalid: true},
+
+		{name: "sticker", content: MessageContent{Type: MessageTypeSticker,
+			Payload: json.RawMessage(`{"packId":"p","stickerId":"s","url":"/uploads/s.webp","emoji":"😀"}`)},
+			typ: MessageTypeSticker, body: "Sticker 😀", payload: `{"packId":"p","stickerId":"s","url":"/uploads/s.webp","emoji":"😀"}`},
+		{name: "sticker without url", content: MessageContent{Type: MessageTypeSticker, Payload: json.RawMessage(`{"packId":"p","stickerId":"s"}`)}, invalid: true},
+
+		{name: "unknown type", content: MessageContent{Type: "video", Body: "x"}, invalid: true},
+		{name: "malformed payload", content: MessageContent{Type: MessageTypeFile, Payload: json.RawMessage(`[1]`)}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.content
+			err := c.Normalize()
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidContent) {
+					t.Fatalf("Normalize() error = %v, want %v", err, ErrInvalidContent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if c.Type != tt.typ || c.Body != tt.body || string(c.Payload) != tt.payload {
+				t.Errorf("Normalize() = %s %q %s, want %s %q %s", c.Type, c.Body, c.Payload, tt.typ, tt.body, tt.payload)
+			}
+		})
+	}
+}
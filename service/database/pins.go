@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+// PinMessage pins a message in its conversation. Any member of a private chat may pin, while in groups only admins
+// may. Pinning an already pinned message is a no-op.
+func (db *appdbimpl) PinMessage(conversationID, messageID, userID string) error {
+	if err := db.checkModerator(conversationID, userID); err != nil {
+		return err
+	}
+
+	// The message must belong to the conversation it is pinned in.
+	var count int
+	err := db.db.QueryRow("SELECT COUNT(*) FROM messages WHERE id = ? AND conversation_id = ?", messageID, conversationID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to look up message: %w", err)
+	}
+	if count == 0 {
+		return ErrMessageNotFound
+	}
+
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	_, err = db.db.Exec(
+		"INSERT OR IGNORE INTO pinned_messages (conversation_id, message_id, pinned_by, pinned_at) VALUES (?, ?, ?, ?)",
+		conversationID, messageID, userID, currentTime,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to pin message: %w", err)
+	}
+	return nil
+}
+
+// UnpinMessage removes a pin from a message, with the same permission rules as PinMessage.
+func (db *appdbimpl) UnpinMessage(conversationID, messageID, userID string) error {
+	if err := db.checkModerator(conversationID, userID); err != nil {
+		return err
+	}
+
+	res, err := db.db.Exec("DELETE FROM pinned_messages WHERE conversation_id = ? AND message_id = ?", conversationID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to unpin message: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to unpin message: %w", err)
+	}
+	if affected == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// GetPinnedMessages returns the pinned messages of a conversation the user is a member of, most recently pinned
+// first. Expired messages the reaper has not deleted yet are left out.
+func (db *appdbimpl) GetPinnedMessages(conversationID, userID string) ([]Message, error) {
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.db.Query(`
+	SELECT m.id, m.conversation_id, m.sender_id, m.type, m.content, m.payload, m.entities, m.reply_to, m.sent_at, m.status, m.deliveredAt, m.readAt,
+	       pm.pinned_by, pm.pinned_at, m.forwarded_from, m.forwarded_from_sender, m.forward_count
+	FROM pinned_messages pm
+	JOIN messages m ON m.id = pm.message_id
+	WHERE pm.conversation_id = ? AND (m.expires_at IS NULL OR m.expires_at > ?)
+	ORDER BY pm.pinned_at DESC`, conversationID, globaltime.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pinned messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var msg Message
+		var payload, entities, replyTo, forwardedFrom, forwardedFromSender sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.Type, &msg.Content, &payload, &entities, &replyTo, &msg.SentAt, &msg.Status, &msg.DeliveredAt, &msg.ReadAt, &msg.PinnedBy, &msg.PinnedAt,
+			&forwardedFrom, &forwardedFromSender, &msg.ForwardCount); err != nil {
+			return nil, fmt.Errorf("failed to scan pinned message: %w", err)
+		}
+		msg.ReplyTo = replyTo.String
+		msg.setForwardedFrom(forwardedFrom, forwardedFromSender)
+		if payload.Valid {
+			msg.Payload = json.RawMessage(payload.String)
+		}
+		msg.Entities = decodeEntities(entities)
+		msg.Pinned = true
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return messages, nil
+}
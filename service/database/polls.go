@@ -0,0 +1,270 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/donnim1/WASAText/service/globaltime"
+)
+
+// PollRequest describes a poll to create.
+type PollRequest struct {
+	Question       string
+	Options        []string
+	MultipleChoice bool
+	Anonymous      bool
+	ClosesAt       time.Time // Zero for polls that never close
+}
+
+// Poll is the state of a poll attached to a message, with tallies as seen by one viewer.
+type Poll struct {
+	Options        []PollOption `json:"options"`
+	MultipleChoice bool         `json:"multipleChoice"`
+	Anonymous      bool         `json:"anonymous"`
+	ClosesAt       string       `json:"closesAt,omitempty"`
+	Closed         bool         `json:"closed"`
+	TotalVoters    int          `json:"totalVoters"`
+	MyVotes        []int        `json:"myVotes"` // Option indexes the viewer voted for
+}
+
+// PollOption is a poll option with its vote count.
+type PollOption struct {
+	Index  int      `json:"index"`
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"` // User IDs; omitted for anonymous polls
+}
+
+// SendPoll sends a message holding the poll question and attaches the poll to it, in one transaction.
+func (db *appdbimpl) SendPoll(senderID, receiverID string, isGroup bool, groupID, conversationID string, poll PollRequest) (string, string, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return "", "", fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", rbErr)
+		}
+	}()
+
+	messageID, conversationID, err := db.sendMessage(tx, senderID, receiverID, MessageContent{Type: MessageTypePoll, Body: poll.Question}, isGroup, conversationID, "")
+	if err != nil {
+		return "", "", err
+	}
+	if err := createPoll(tx, messageID, poll); err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return messageID, conversationID, nil
+}
+
+// createPoll stores the poll and its options for a message.
+func createPoll(q dbtx, messageID string, poll PollRequest) error {
+	var closesAt interface{}
+	if !poll.ClosesAt.IsZero() {
+		closesAt = poll.ClosesAt.UTC().Format(time.RFC3339)
+	}
+	_, err := q.Exec("INSERT INTO polls (message_id, multiple_choice, anonymous, closes_at) VALUES (?, ?, ?, ?)",
+		messageID, poll.MultipleChoice, poll.Anonymous, closesAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert poll: %w", err)
+	}
+	for i, option := range poll.Options {
+		_, err = q.Exec("INSERT INTO poll_options (message_id, option_index, text) VALUES (?, ?, ?)", messageID, i, option)
+		if err != nil {
+			return fmt.Errorf("failed to insert poll option: %w", err)
+		}
+	}
+	return nil
+}
+
+// VotePoll replaces the user's votes on an open poll. Single-choice polls accept at most one option.
+func (db *appdbimpl) VotePoll(messageID, userID string, options []int) error {
+	var conversationID string
+	var multipleChoice bool
+	var closesAt sql.NullString
+	err := db.db.QueryRow(`
+		SELECT m.conversation_id, p.multiple_choice, p.closes_at
+		FROM polls p JOIN messages m ON m.id = p.message_id
+		WHERE p.message_id = ?`, messageID).Scan(&conversationID, &multipleChoice, &closesAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPollNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to look up poll: %w", err)
+	}
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return err
+	}
+
+	var optionCount int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM poll_options WHERE message_id = ?", messageID).Scan(&optionCount); err != nil {
+		return fmt.Errorf("failed to count poll options: %w", err)
+	}
+	if err := checkVote(multipleChoice, closesAt, optionCount, options, globaltime.Now()); err != nil {
+		return err
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", rbErr)
+		}
+	}()
+
+	if _, err := tx.Exec("DELETE FROM poll_votes WHERE message_id = ? AND user_id = ?", messageID, userID); err != nil {
+		return fmt.Errorf("failed to clear previous votes: %w", err)
+	}
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	for _, option := range options {
+		_, err := tx.Exec("INSERT INTO poll_votes (message_id, option_index, user_id, voted_at) VALUES (?, ?, ?, ?)",
+			messageID, option, userID, currentTime)
+		if err != nil {
+			return fmt.Errorf("failed to insert vote: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
+
+// checkVote validates a vote for options, made at now, on a poll with optionCount options closing at closesAt.
+func checkVote(multipleChoice bool, closesAt sql.NullString, optionCount int, options []int, now time.Time) error {
+	if pollClosed(closesAt, now) {
+		return ErrPollClosed
+	}
+	if !multipleChoice && len(options) > 1 {
+		return fmt.Errorf("%w: single-choice poll", ErrInvalidVote)
+	}
+	seen := make(map[int]bool, len(options))
+	for _, option := range options {
+		if option < 0 || option >= optionCount || seen[option] {
+			return fmt.Errorf("%w: option %d", ErrInvalidVote, option)
+		}
+		seen[option] = true
+	}
+	return nil
+}
+
+// pollClosed reports whether a poll with the given close time is closed at now.
+func pollClosed(closesAt sql.NullString, now time.Time) bool {
+	if !closesAt.Valid {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, closesAt.String)
+	return err == nil && !now.Before(t)
+}
+
+// attachPolls sets Message.Poll, with tallies, for every poll among messages.
+func (db *appdbimpl) attachPolls(messages []Message, viewerID string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messages)), ",")
+	args := make([]interface{}, len(messages))
+	index := make(map[string]int, len(messages))
+	for i, msg := range messages {
+		args[i] = msg.ID
+		index[msg.ID] = i
+	}
+
+	rows, err := db.db.Query("SELECT message_id, multiple_choice, anonymous, closes_at FROM polls WHERE message_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return fmt.Errorf("failed to query polls: %w", err)
+	}
+	defer rows.Close()
+	now := globaltime.Now()
+	found := false
+	for rows.Next() {
+		var messageID string
+		var closesAt sql.NullString
+		poll := &Poll{Options: []PollOption{}, MyVotes: []int{}}
+		if err := rows.Scan(&messageID, &poll.MultipleChoice, &poll.Anonymous, &closesAt); err != nil {
+			return fmt.Errorf("failed to scan poll: %w", err)
+		}
+		poll.ClosesAt = closesAt.String
+		poll.Closed = pollClosed(closesAt, now)
+		messages[index[messageID]].Poll = poll
+		found = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("poll rows iteration error: %w", err)
+	}
+	if !found {
+		return nil
+	}
+
+	optionRows, err := db.db.Query("SELECT message_id, option_index, text FROM poll_options WHERE message_id IN ("+placeholders+") ORDER BY message_id, option_index", args...)
+	if err != nil {
+		return fmt.Errorf("failed to query poll options: %w", err)
+	}
+	defer optionRows.Close()
+	for optionRows.Next() {
+		var messageID string
+		var option PollOption
+		if err := optionRows.Scan(&messageID, &option.Index, &option.Text); err != nil {
+			return fmt.Errorf("failed to scan poll option: %w", err)
+		}
+		poll := messages[index[messageID]].Poll
+		poll.Options = append(poll.Options, option)
+	}
+	if err := optionRows.Err(); err != nil {
+		return fmt.Errorf("poll option rows iteration error: %w", err)
+	}
+
+	voteRows, err := db.db.Query("SELECT message_id, option_index, user_id FROM poll_votes WHERE message_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return fmt.Errorf("failed to query poll votes: %w", err)
+	}
+	defer voteRows.Close()
+	votes := make(map[string][]pollVote)
+	for voteRows.Next() {
+		var messageID string
+		var vote pollVote
+		if err := voteRows.Scan(&messageID, &vote.Option, &vote.UserID); err != nil {
+			return fmt.Errorf("failed to scan poll vote: %w", err)
+		}
+		votes[messageID] = append(votes[messageID], vote)
+	}
+	if err := voteRows.Err(); err != nil {
+		return fmt.Errorf("poll vote rows iteration error: %w", err)
+	}
+	for messageID, v := range votes {
+		messages[index[messageID]].Poll.tally(v, viewerID)
+	}
+	return nil
+}
+
+// pollVote is a user's vote for one option of a poll.
+type pollVote struct {
+	Option int
+	UserID string
+}
+
+// tally counts votes into the options of p as seen by viewerID. Voters are only listed on polls that are not
+// anonymous, but the viewer's own votes always are. Votes for options that no longer exist are ignored.
+func (p *Poll) tally(votes []pollVote, viewerID string) {
+	voters := make(map[string]bool)
+	for _, vote := range votes {
+		if vote.Option < 0 || vote.Option >= len(p.Options) {
+			continue
+		}
+		option := &p.Options[vote.Option]
+		option.Votes++
+		if !p.Anonymous {
+			option.Voters = append(option.Voters, vote.UserID)
+		}
+		if vote.UserID == viewerID {
+			p.MyVotes = append(p.MyVotes, vote.Option)
+		}
+		voters[vote.UserID] = true
+	}
+	p.TotalVoters = len(voters)
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPollClosed(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		closesAt sql.NullString
+		want     bool
+	}{
+		{name: "never closes", closesAt: sql.NullString{}},
+		{name: "closes later", closesAt: sql.NullString{String: "2024-05-01T12:00:01Z", Valid: true}},
+		{name: "closes now", closesAt: sql.NullString{String: "2024-05-01T12:00:00Z", Valid: true}, want: true},
+		{name: "closed", closesAt: sql.NullString{String: "2024-04-30T12:00:00Z", Valid: true}, want: true},
+		{name: "other time zone", closesAt: sql.NullString{String: "2024-05-01T13:30:00+02:00", Valid: true}, want: true},
+		{name: "unparsable", closesAt: sql.NullString{String: "2024-04-30 12:00:00", Valid: true}},
+	}
+	for _, tt := range tests {
+		if got := pollClosed(tt.closesAt, now); got != tt.want {
+			t.Errorf("%s: pollClosed(%q) = %v, want %v", tt.name, tt.closesAt.String, got, tt.want)
+		}
+	}
+}
+
+func TestCheckVote(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	open := sql.NullString{String: "2024-05-02T00:00:00Z", Valid: true}
+	closed := sql.NullString{String: "2024-05-01T00:00:00Z", Valid: true}
+	tests := []struct {
+		name           string
+		multipleChoice bool
+		closesAt       sql.NullString
+		options        []int
+		err            error
+	}{
+		{name: "single choice", options: []int{2}},
+		{name: "single choice with two options", options: []int{0, 1}, err: ErrInvalidVote},
+		{name: "multiple choice", multipleChoice: true, options: []int{0, 2}},
+		{name: "retracted vote", options: nil},
+		{name: "open poll", closesAt: open, options: []int{0}},
+		{name: "closed poll", closesAt: closed, options: []int{0}, err: ErrPollClosed},
+		{name: "closed poll with a retracted vote", closesAt: closed, options: nil, err: ErrPollClosed},
+		{name: "negative option", options: []int{-1}, err: ErrInvalidVote},
+		{name: "option out of range", options: []int{3}, err: ErrInvalidVote},
+		{name: "duplicate option", multipleChoice: true, options: []int{1, 1}, err: ErrInvalidVote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVote(tt.multipleChoice, tt.closesAt, 3, tt.options, now)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("checkVote(%v) error = %v, want %v", tt.options, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPollTally(t *testing.T) {
+	votes := []pollVote{
+		{Option: 0, UserID: "alice"},
+		{Option: 1, UserID: "alice"},
+		{Option: 1, UserID: "bob"},
+		{Option: 2, UserID: "me"},
+		{Option: 5, UserID: "carol"}, // Option no longer exists
+	}
+	tests := []struct {
+		name      string
+		anonymous bool
+		votes     []pollVote
+		want      Poll
+	}{
+		{name: "no votes", want: Poll{
+			Options: []PollOption{{Index: 0, Text: "a"}, {Index: 1, Text: "b"}, {Index: 2, Text: "c"}},
+			MyVotes: []int{},
+		}},
+		{name: "public", votes: votes, want: Poll{
+			Options: []PollOption{
+				{Index: 0, Text: "a", Votes: 1, Voters: []string{"alice"}},
+				{Index: 1, Text: "b", Votes: 2, Voters: []string{"alice", "bob"}},
+				{Index: 2, Text: "c", Votes: 1, Voters: []string{"me"}},
+			},
+			TotalVoters: 3,
+			MyVotes:     []int{2},
+		}},
+		{name: "anonymous", anonymous: true, votes: votes, want: Poll{
+			Anonymous: true,
+			Options: []PollOption{
+				{Index: 0, Text: "a", Votes: 1},
+				{Index: 1, Text: "b", Votes: 2},
+				{Index: 2, Text: "c", Votes: 1},
+			},
+			TotalVoters: 3,
+			MyVotes:     []int{2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poll := Poll{
+				Options:   []PollOption{{Index: 0, Text: "a"}, {Index: 1, Text: "b"}, {Index: 2, Text: "c"}},
+				Anonymous: tt.anonymous,
+				MyVotes:   []int{},
+			}
+			poll.tally(tt.votes, "me")
+			if !reflect.DeepEqual(poll, tt.want) {
+				t.Errorf("tally() = %+v, want %+v", poll, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Audiences of a privacy setting.
+const (
+	VisibleToEveryone = "everyone"
+	VisibleToContacts = "contacts"
+	VisibleToNobody   = "nobody"
+)
+
+// ErrInvalidPrivacy is returned for privacy settings other than the audiences above.
+var ErrInvalidPrivacy = errors.New("invalid privacy setting")
+
+// PrivacySettings tell who sees a user's profile photo and last seen time, whether senders learn that the user
+// read their messages, and who may start a private chat with them; the first messages of others land in the user's
+// message requests. Users always see their own details.
+type PrivacySettings struct {
+	Photo        string `json:"photo"`
+	LastSeen     string `json:"lastSeen"`
+	ReadReceipts string `json:"readReceipts"`
+	Messages     string `json:"messages"`
+}
+
+// contactCondition is true when the viewer cv is a contact of the user u: u saved them in their contacts list, or
+// they share a private chat that is not a message request.
+const contactCondition = `(EXISTS (SELECT 1 FROM contacts cl WHERE cl.owner_id = u.id AND cl.contact_id = cv.id)
+	OR EXISTS (SELECT 1 FROM group_members ca
+		JOIN group_members cb ON cb.group_id = ca.group_id AND cb.user_id = cv.id
+		JOIN conversations cc ON cc.id = ca.group_id AND cc.is_group = 0 AND cc.request_status = ''
+		WHERE ca.user_id = u.id))`
+
+// blockedCondition is true when the user u or the viewer cv blocked the other.
+const blockedCondition = `EXISTS (SELECT 1 FROM user_blocks ub
+	WHERE (ub.blocker_id = u.id AND ub.blocked_id = cv.id) OR (ub.blocker_id = cv.id AND ub.blocked_id = u.id))`
+
+// visibleTo returns the condition under which the privacy setting in column of the user u allows the viewer (bound
+// twice) to see the detail. Users who blocked each other see nothing of the other.
+func visibleTo(column string) string {
+	return "(u.id = ? OR EXISTS (SELECT 1 FROM users cv WHERE cv.id = ? AND NOT " + blockedCondition +
+		" AND (u." + column + " = '" + VisibleToEveryone + "' OR (u." + column + " = '" + VisibleToContacts +
+		"' AND " + contactCondition + "))))"
+}
+
+// visiblePhoto is the photo URL of the user u that the viewer (bound twice) may see, or NULL.
+var visiblePhoto = "CASE WHEN " + visibleTo("photo_visibility") + " THEN u.photo_url END"
+
+func validVisibility(v string) bool {
+	return v == VisibleToEveryone || v == VisibleToContacts || v == VisibleToNobody
+}
+
+// GetPrivacySettings returns the privacy settings of a user.
+func (db *appdbimpl) GetPrivacySettings(userID string) (PrivacySettings, error) {
+	var s PrivacySettings
+	err := db.db.QueryRow(`SELECT photo_visibility, last_seen_visibility, read_receipts_visibility, messages_visibility
+		FROM users WHERE id = ?`, userID).Scan(&s.Photo, &s.LastSeen, &s.ReadReceipts, &s.Messages)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PrivacySettings{}, ErrUserNotFound
+	} else if err != nil {
+		return PrivacySettings{}, fmt.Errorf("failed to get privacy settings: %w", err)
+	}
+	return s, nil
+}
+
+// UpdatePrivacySettings changes the privacy settings of a user. Empty fields keep their current value.
+func (db *appdbimpl) UpdatePrivacySettings(userID string, s PrivacySettings) (PrivacySettings, error) {
+	for _, v := range []string{s.Photo, s.LastSeen, s.ReadReceipts, s.Messages} {
+		if v != "" && !validVisibility(v) {
+			return PrivacySettings{}, fmt.Errorf("%w: %q is not everyone, contacts or nobody", ErrInvalidPrivacy, v)
+		}
+	}
+	res, err := db.db.Exec(`UPDATE users SET
+		photo_visibility = COALESCE(NULLIF(?, ''), photo_visibility),
+		last_seen_visibility = COALESCE(NULLIF(?, ''), last_seen_visibility),
+		read_receipts_visibility = COALESCE(NULLIF(?, ''), read_receipts_visibility),
+		messages_visibility = COALESCE(NULLIF(?, ''), messages_visibility)
+		WHERE id = ?`, s.Photo, s.LastSeen, s.ReadReceipts, s.Messages, userID)
+	if err != nil {
+		return PrivacySettings{}, fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return PrivacySettings{}, fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+	if affected == 0 {
+		return PrivacySettings{}, ErrUserNotFound
+	}
+	return db.GetPrivacySettings(userID)
+}
+
+// UpdateLastSeen records that the user was active at the given time.
+func (db *appdbimpl) UpdateLastSeen(userID string, at time.Time) error {
+	_, err := db.db.Exec("UPDATE users SET last_seen_at = ? WHERE id = ?", at.UTC().Format(time.RFC3339), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last seen: %w", err)
+	}
+	return nil
+}
+
+// readReceiptsVisible reports whether the reader lets the sender of a message learn that they read it.
+func readReceiptsVisible(q dbtx, readerID, senderID string) (bool, error) {
+	var visible bool
+	err := q.QueryRow("SELECT "+visibleTo("read_receipts_visibility")+" FROM users u WHERE u.id = ?",
+		senderID, senderID, readerID).Scan(&visible)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrUserNotFound
+	} else if err != nil {
+		return false, fmt.Errorf("failed to check read receipt setting: %w", err)
+	}
+	return visible, nil
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxReactionLength is the maximum length in bytes of a reaction, enough for emoji built from several code points.
+const maxReactionLength = 32
+
+// ErrInvalidReaction is returned for reactions that are empty, too long or contain spaces.
+var ErrInvalidReaction = errors.New("invalid reaction")
+
+// ErrReactionNotFound is returned when removing a reaction the user has not made.
+var ErrReactionNotFound = errors.New("reaction not found")
+
+// ReactionSummary aggregates the reactions with one emoji on a message.
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reactedByMe"`
+}
+
+// validReaction reports whether reaction can be stored. Reactions are meant to be emoji, but any short token
+// without whitespace is accepted.
+func validReaction(reaction string) bool {
+	if reaction == "" || len(reaction) > maxReactionLength {
+		return false
+	}
+	return strings.IndexFunc(reaction, unicode.IsSpace) < 0
+}
+
+// RemoveReaction removes one of the user's reactions from a message.
+func (db *appdbimpl) RemoveReaction(messageID, userID, reaction string) error {
+	res, err := db.db.Exec("DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND reaction = ?",
+		messageID, userID, reaction)
+	if err != nil {
+		return fmt.Errorf("failed to delete reaction: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check deletion: %w", err)
+	}
+	if affected == 0 {
+		return ErrReactionNotFound
+	}
+	return nil
+}
+
+// GetMessageReactions lists who reacted to a message, oldest reaction first. If emoji is not empty only reactions
+// with that emoji are listed. The user must be a member of the message's conversation.
+func (db *appdbimpl) GetMessageReactions(messageID, userID, emoji string) ([]Reaction, error) {
+	conversationID, err := db.messageConversationID(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.db.Query(`
+		SELECT mr.reaction, u.id, u.username, mr.reacted_at
+		FROM message_reactions mr
+		JOIN users u ON u.id = mr.user_id
+		WHERE mr.message_id = ? AND (? = '' OR mr.reaction = ?)
+		ORDER BY mr.reacted_at ASC`, messageID, emoji, emoji)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reactions: %w", err)
+	}
+	defer rows.Close()
+
+	reactions := []Reaction{}
+	for rows.Next() {
+		var r Reaction
+		var reactedAt sql.NullString
+		if err := rows.Scan(&r.Reaction, &r.UserID, &r.UserName, &reactedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		r.ReactedAt = reactedAt.String
+		reactions = append(reactions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return reactions, nil
+}
+
+// attachReactions sets the aggregated reactions of each message, most used emoji first.
+func (db *appdbimpl) attachReactions(messages []Message, viewerID string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messages)), ",")
+	args := []interface{}{viewerID}
+	for _, msg := range messages {
+		args = append(args, msg.ID)
+	}
+
+	rows, err := db.db.Query(`
+		SELECT message_id, reaction, COUNT(*), MAX(user_id = ?)
+		FROM message_reactions
+		WHERE message_id IN (`+placeholders+`)
+		GROUP BY message_id, reaction
+		ORDER BY COUNT(*) DESC, MIN(reacted_at) ASC`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query reactions: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make(map[string][]ReactionSummary)
+	for rows.Next() {
+		var messageID string
+		var s ReactionSummary
+		if err := rows.Scan(&messageID, &s.Emoji, &s.Count, &s.ReactedByMe); err != nil {
+			return fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		summaries[messageID] = append(summaries[messageID], s)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("reaction rows iteration error: %w", err)
+	}
+
+	for i := range messages {
+		if s, ok := summaries[messages[i].ID]; ok {
+			messages[i].Reactions = s
+		} else {
+			messages[i].Reactions = []ReactionSummary{}
+		}
+	}
+	return nil
+}
+
+// migrateReactionsKey rebuilds a message_reactions table created when its primary key was (message_id, user_id),
+// which allowed a single reaction per user and message. Rows of that table were timestamped by CURRENT_TIMESTAMP;
+// they are copied in RFC 3339 like newer ones, so that reactions sort by time.
+func migrateReactionsKey(db *sql.DB) error {
+	var pk int
+	err := db.QueryRow("SELECT pk FROM pragma_table_info('message_reactions') WHERE name = 'reaction'").Scan(&pk)
+	if err != nil {
+		return fmt.Errorf("failed to read table info: %w", err)
+	}
+	if pk > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("transaction start failed: %w", err)
+	}
+	defer func() {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", rbErr)
+		}
+	}()
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	statements := []string{
+		`CREATE TABLE message_reactions_new (` + messageReactionsColumns + `)`,
+		`INSERT INTO message_reactions_new (message_id, user_id, reaction, reacted_at)
+			SELECT message_id, user_id, reaction, COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', reacted_at), '` + currentTime + `')
+			FROM message_reactions`,
+		`DROP TABLE message_reactions`,
+		`ALTER TABLE message_reactions_new RENAME TO message_reactions`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to rebuild message_reactions: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Values of conversations.request_status. Accepted requests become ordinary conversations, with an empty status.
+const (
+	requestPending  = "pending"
+	requestDeclined = "declined"
+)
+
+// ErrRequestNotFound is returned for message requests that do not exist or were not sent to the user.
+var ErrRequestNotFound = errors.New("message request not found")
+
+// MessageRequest is a private chat started by a user the recipient's privacy settings do not let message them. It
+// stays out of the recipient's conversations until they accept it.
+type MessageRequest struct {
+	ConversationID    string      `json:"conversationId"`
+	Sender            UserSummary `json:"sender"`
+	CreatedAt         string      `json:"createdAt"`
+	MessageCount      int         `json:"messageCount"`
+	LastMessage       string      `json:"lastMessage"`
+	LastMessageSentAt string      `json:"lastMessageSentAt"`
+}
+
+// hiddenRequestCondition is true when the conversation c is a message request the user gm.user_id received and has
+// not accepted.
+const hiddenRequestCondition = `(c.request_status != '' AND c.requested_by != gm.user_id)`
+
+// messagingAllowed reports whether the privacy settings of receiverID let senderID start a private chat with them.
+func messagingAllowed(q dbtx, senderID, receiverID string) (bool, error) {
+	var allowed bool
+	err := q.QueryRow("SELECT "+visibleTo("messages_visibility")+" FROM users u WHERE u.id = ?",
+		senderID, senderID, receiverID).Scan(&allowed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrUserNotFound
+	} else if err != nil {
+		return false, fmt.Errorf("failed to check messaging setting: %w", err)
+	}
+	return allowed, nil
+}
+
+// GetMessageRequests returns the pending message requests sent to the user, most recent first.
+func (db *appdbimpl) GetMessageRequests(userID string) ([]MessageRequest, error) {
+	rows, err := db.db.Query(`
+		SELECT c.id, c.created_at, u.id, u.username,
+			`+visiblePhoto+`,
+			(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id),
+			COALESCE((SELECT content FROM messages m WHERE m.conversation_id = c.id ORDER BY sent_at DESC LIMIT 1), ''),
+			COALESCE((SELECT sent_at FROM messages m WHERE m.conversation_id = c.id ORDER BY sent_at DESC LIMIT 1), '')
+		FROM conversations c
+		JOIN group_members gm ON gm.group_id = c.id AND gm.user_id = ?
+		JOIN users u ON u.id = c.requested_by
+		WHERE c.request_status = ? AND c.requested_by != ?
+		ORDER BY 8 DESC`, userID, userID, userID, requestPending, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []MessageRequest{}
+	for rows.Next() {
+		var r MessageRequest
+		var photo sql.NullString
+		if err := rows.Scan(&r.ConversationID, &r.CreatedAt, &r.Sender.ID, &r.Sender.Username, &photo,
+			&r.MessageCount, &r.LastMessage, &r.LastMessageSentAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message request: %w", err)
+		}
+		r.Sender.PhotoUrl = photo.String
+		requests = append(requests, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return requests, nil
+}
+
+// AcceptMessageRequest turns a message request sent to the user, pending or declined, into an ordinary conversation.
+func (db *appdbimpl) AcceptMessageRequest(conversationID, userID string) error {
+	return db.setRequestStatus(conversationID, userID, "", requestPending, requestDeclined)
+}
+
+// DeclineMessageRequest hides a pending message request sent to the user for good. The sender is not told.
+func (db *appdbimpl) DeclineMessageRequest(conversationID, userID string) error {
+	return db.setRequestStatus(conversationID, userID, requestDeclined, requestPending)
+}
+
+// setRequestStatus moves a request the user received from one of the statuses from to status.
+func (db *appdbimpl) setRequestStatus(conversationID, userID, status string, from ...string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(from)), ",")
+	query := `UPDATE conversations SET request_status = ?
+		WHERE id = ? AND requested_by != ? AND request_status IN (` + placeholders + `)
+		AND id IN (SELECT group_id FROM group_members WHERE user_id = ?)`
+	args := []interface{}{status, conversationID, userID}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	res, err := db.db.Exec(query, append(args, userID)...)
+	if err != nil {
+		return fmt.Errorf("failed to update message request: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update message request: %w", err)
+	}
+	if affected == 0 {
+		return ErrRequestNotFound
+	}
+	return nil
+}
+
+// acceptOnReply accepts the message request in conversationID, if any, when its recipient userID writes to it.
+func acceptOnReply(q dbtx, conversationID, userID string) error {
+	_, err := q.Exec("UPDATE conversations SET request_status = '' WHERE id = ? AND request_status != '' AND requested_by != ?",
+		conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to accept message request: %w", err)
+	}
+	return nil
+}
+
+// isReceivedRequest reports whether conversationID is a message request userID received and has not accepted.
+func isReceivedRequest(q dbtx, conversationID, userID string) (bool, error) {
+	var received bool
+	err := q.QueryRow("SELECT EXISTS (SELECT 1 FROM conversations WHERE id = ? AND request_status != '' AND requested_by != ?)",
+		conversationID, userID).Scan(&received)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up message request: %w", err)
+	}
+	return received, nil
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/donnim1/WASAText/service/markup"
+)
+
+// ScheduledMessage is a message waiting to be sent by the dispatcher. Its fields mirror the arguments of SendMessage.
+type ScheduledMessage struct {
+	ID             string          `json:"id"`
+	SenderID       string          `json:"senderId"`
+	ReceiverID     string          `json:"receiverId,omitempty"`
+	ConversationID string          `json:"conversationId,omitempty"`
+	GroupID        string          `json:"groupId,omitempty"`
+	IsGroup        bool            `json:"isGroup"`
+	Type           string          `json:"type"`
+	Content        string          `json:"content"`
+	Payload        json.RawMessage `json:"payload,omitempty"` // See MessageContent
+	Entities       []markup.Entity `json:"entities,omitempty"`
+	AttachmentID   string          `json:"attachmentId,omitempty"` // Resolved when the message is scheduled
+	ReplyTo        string          `json:"replyTo,omitempty"`
+	SendAt         string          `json:"sendAt"`
+	CreatedAt      string          `json:"createdAt"`
+	Status         string          `json:"status"` // "pending", "dispatching" or "failed"
+	Error          string          `json:"error,omitempty"`
+}
+
+// MessageContent returns the content the message will be sent with.
+func (sm ScheduledMessage) MessageContent() MessageContent {
+	return MessageContent{Type: sm.Type, Body: sm.Content, Payload: sm.Payload, Entities: sm.Entities, AttachmentID: sm.AttachmentID}
+}
+
+const scheduledMessageColumns = `id, sender_id, receiver_id, conversation_id, group_id, is_group, type, content, payload, entities, reply_to,
+	send_at, created_at, status, error`
+
+// ScheduleMessage stores a message to be sent at sm.SendAt, which must be an RFC3339 timestamp. The content is
+// validated now so that the dispatcher does not fail on it later.
+func (db *appdbimpl) ScheduleMessage(sm ScheduledMessage) (string, error) {
+	sendAt, err := time.Parse(time.RFC3339, sm.SendAt)
+	if err != nil {
+		return "", fmt.Errorf("invalid send time: %w", err)
+	}
+	content := sm.MessageContent()
+	if err := resolveAttachment(db.db, &content, sm.SenderID); err != nil {
+		return "", err
+	}
+	if err := resolveSticker(db.db, &content, sm.SenderID); err != nil {
+		return "", err
+	}
+	if err := content.Normalize(); err != nil {
+		return "", err
+	}
+
+	scheduledID, err := GenerateNewID()
+	if err != nil {
+		return "", fmt.Errorf("GenerateNewID error: %w", err)
+	}
+
+	entities, err := encodeEntities(content.Entities)
+	if err != nil {
+		return "", err
+	}
+
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	_, err = db.db.Exec(`INSERT INTO scheduled_messages
+		(id, sender_id, receiver_id, conversation_id, group_id, is_group, type, content, payload, entities, reply_to, send_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		scheduledID, sm.SenderID, sm.ReceiverID, sm.ConversationID, sm.GroupID, sm.IsGroup,
+		content.Type, content.Body, nullablePayload(content.Payload), entities, sm.ReplyTo,
+		sendAt.UTC().Format(time.RFC3339), currentTime)
+	if err != nil {
+		return "", fmt.Errorf("failed to schedule message: %w", err)
+	}
+	return scheduledID, nil
+}
+
+// GetScheduledMessages returns the messages the user has scheduled, soonest first.
+func (db *appdbimpl) GetScheduledMessages(userID string) ([]ScheduledMessage, error) {
+	return db.queryScheduledMessages(
+		"SELECT "+scheduledMessageColumns+" FROM scheduled_messages WHERE sender_id = ? ORDER BY send_at ASC", userID)
+}
+
+// CancelScheduledMessage deletes a pending or failed scheduled message owned by the user.
+func (db *appdbimpl) CancelScheduledMessage(scheduledID, userID string) error {
+	res, err := db.db.Exec(
+		"DELETE FROM scheduled_messages WHERE id = ? AND sender_id = ? AND status != 'dispatching'", scheduledID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled message: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled message: %w", err)
+	}
+	if affected == 0 {
+		return ErrScheduledMessageNotFound
+	}
+	return nil
+}
+
+// RescheduleMessage changes the send time of a pending or failed scheduled message owned by the user. A failed
+// message becomes pending again.
+func (db *appdbimpl) RescheduleMessage(scheduledID, userID string, sendAt time.Time) error {
+	res, err := db.db.Exec(`UPDATE scheduled_messages SET send_at = ?, status = 'pending', error = ''
+		WHERE id = ? AND sender_id = ? AND status != 'dispatching'`,
+		sendAt.UTC().Format(time.RFC3339), scheduledID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule message: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to reschedule message: %w", err)
+	}
+	if affected == 0 {
+		return ErrScheduledMessageNotFound
+	}
+	return nil
+}
+
+// GetDueScheduledMessages returns up to limit pending messages whose send time is not after now, oldest first.
+func (db *appdbimpl) GetDueScheduledMessages(now time.Time, limit int) ([]ScheduledMessage, error) {
+	return db.queryScheduledMessages(
+		"SELECT "+scheduledMessageColumns+` FROM scheduled_messages
+		WHERE status = 'pending' AND send_at <= ? ORDER BY send_at ASC LIMIT ?`,
+		now.UTC().Format(time.RFC3339), limit)
+}
+
+// ClaimScheduledMessage moves a pending message to "dispatching" so that it can no longer be cancelled.
+func (db *appdbimpl) ClaimScheduledMessage(scheduledID string) (bool, error) {
+	res, err := db.db.Exec(
+		"UPDATE scheduled_messages SET status = 'dispatching' WHERE id = ? AND status = 'pending'", scheduledID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim scheduled message: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim scheduled message: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// FinishScheduledMessage deletes a dispatched message, or keeps it as failed with the given reason so that the
+// sender can see it and reschedule.
+func (db *appdbimpl) FinishScheduledMessage(scheduledID, failure string) error {
+	var err error
+	if failure == "" {
+		_, err = db.db.Exec("DELETE FROM scheduled_messages WHERE id = ?", scheduledID)
+	} else {
+		_, err = db.db.Exec("UPDATE scheduled_messages SET status = 'failed', error = ? WHERE id = ?", failure, scheduledID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish scheduled message: %w", err)
+	}
+	return nil
+}
+
+// queryScheduledMessages runs a query selecting scheduledMessageColumns and scans the result.
+func (db *appdbimpl) queryScheduledMessages(query string, args ...interface{}) ([]ScheduledMessage, error) {
+	rows, err := db.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	scheduled := []ScheduledMessage{}
+	for rows.Next() {
+		var sm ScheduledMessage
+		var payload, entities sql.NullString
+		if err := rows.Scan(&sm.ID, &sm.SenderID, &sm.ReceiverID, &sm.ConversationID, &sm.GroupID, &sm.IsGroup,
+			&sm.Type, &sm.Content, &payload, &entities, &sm.ReplyTo, &sm.SendAt, &sm.CreatedAt, &sm.Status, &sm.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled message: %w", err)
+		}
+		if payload.Valid {
+			sm.Payload = json.RawMessage(payload.String)
+		}
+		sm.Entities = decodeEntities(entities)
+		scheduled = append(scheduled, sm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return scheduled, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// StarredMessage is a message starred by a user, together with the context of its conversation.
+type StarredMessage struct {
+	Message
+	ConversationName string `json:"conversationName"`
+	IsGroup          bool   `json:"isGroup"`
+	StarredAt        string `json:"starredAt"`
+	// IsMember is false when the user has left the conversation since starring; Content is withheld then.
+	IsMember bool `json:"isMember"`
+}
+
+// StarMessage bookmarks a message for the user. Starring an already starred message is a no-op.
+func (db *appdbimpl) StarMessage(messageID, userID string) error {
+	conversationID, err := db.messageConversationID(messageID)
+	if err != nil {
+		return err
+	}
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return err
+	}
+
+	currentTime := time.Now().UTC().Format(time.RFC3339)
+	_, err = db.db.Exec(
+		"INSERT OR IGNORE INTO starred_messages (user_id, message_id, starred_at) VALUES (?, ?, ?)",
+		userID, messageID, currentTime,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to star message: %w", err)
+	}
+	return nil
+}
+
+// UnstarMessage removes a message from the user's starred messages.
+func (db *appdbimpl) UnstarMessage(messageID, userID string) error {
+	res, err := db.db.Exec("DELETE FROM starred_messages WHERE user_id = ? AND message_id = ?", userID, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to unstar message: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to unstar message: %w", err)
+	}
+	if affected == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// GetStarredMessages returns the user's starred messages, most recently starred first. Messages from conversations
+// the user no longer belongs to are flagged with IsMember false and their content is withheld.
+func (db *appdbimpl) GetStarredMessages(userID string) ([]StarredMessage, error) {
+	rows, err := db.db.Query(`
+	SELECT m.id, m.conversation_id, m.sender_id, m.type, m.content, m.payload, m.entities, m.reply_to, m.sent_at, m.status,
+	       c.is_group,
+	       CASE WHEN c.is_group = 1 THEN c.name
+	            ELSE (SELECT u.username FROM group_members gm JOIN users u ON u.id = gm.user_id
+	                  WHERE gm.group_id = c.id AND gm.user_id != ? LIMIT 1)
+	       END AS conversation_name,
+	       sm.starred_at, m.forwarded_from, m.forwarded_from_sender, m.forward_count,
+	       EXISTS (SELECT 1 FROM group_members WHERE group_id = c.id AND user_id = ?) AS is_member
+	FROM starred_messages sm
+	JOIN messages m ON m.id = sm.message_id
+	JOIN conversations c ON c.id = m.conversation_id
+	WHERE sm.user_id = ?
+	ORDER BY sm.starred_at DESC`, userID, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query starred messages: %w", err)
+	}
+	defer rows.Close()
+
+	starred := []StarredMessage{}
+	for rows.Next() {
+		var sm StarredMessage
+		var payload, entities, replyTo, name, forwardedFrom, forwardedFromSender sql.NullString
+		if err := rows.Scan(&sm.ID, &sm.ConversationID, &sm.SenderID, &sm.Type, &sm.Content, &payload, &entities, &replyTo, &sm.SentAt, &sm.Status,
+			&sm.IsGroup, &name, &sm.StarredAt,
+			&forwardedFrom, &forwardedFromSender, &sm.ForwardCount, &sm.IsMember); err != nil {
+			return nil, fmt.Errorf("failed to scan starred message: %w", err)
+		}
+		sm.ReplyTo = replyTo.String
+		sm.ConversationName = name.String
+		sm.setForwardedFrom(forwardedFrom, forwardedFromSender)
+		if !sm.IsMember {
+			sm.Content = ""
+		} else {
+			if payload.Valid {
+				sm.Payload = json.RawMessage(payload.String)
+			}
+			sm.Entities = decodeEntities(entities)
+		}
+		starred = append(starred, sm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return starred, nil
+}
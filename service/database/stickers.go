@@ -0,0 +1,395 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits on sticker packs.
+const (
+	maxStickerPackNameLength = 64
+	MaxStickersPerPack       = 120
+	maxStickerEmojis         = 10
+)
+
+var (
+	// ErrStickerPackNotFound is returned for packs that do not exist or that the user has no access to.
+	ErrStickerPackNotFound = errors.New("sticker pack not found")
+	// ErrStickerNotFound is returned for stickers that do not exist in the pack, or that the sender has not installed.
+	ErrStickerNotFound = errors.New("sticker not found")
+	// ErrNotPackOwner is returned when someone other than its owner changes a sticker pack.
+	ErrNotPackOwner = errors.New("user does not own the sticker pack")
+	// ErrInvalidSticker is returned for pack names, stickers and emoji tags that cannot be stored.
+	ErrInvalidSticker = errors.New("invalid sticker")
+)
+
+// StickerPack is a named set of stickers. Its owner adds the stickers; anyone it is shared with may install it.
+type StickerPack struct {
+	ID        string    `json:"id"`
+	OwnerID   string    `json:"ownerId"`
+	Name      string    `json:"name"`
+	CreatedAt string    `json:"createdAt"`
+	Installed bool      `json:"installed"` // By the user the pack was read for
+	Stickers  []Sticker `json:"stickers"`
+}
+
+// Sticker is an image in a sticker pack, tagged with the emoji it is found by.
+type Sticker struct {
+	ID        string   `json:"id"`
+	PackID    string   `json:"packId"`
+	URL       string   `json:"url"`
+	MimeType  string   `json:"mimeType"`
+	Emojis    []string `json:"emojis"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+// normalizeStickerEmojis trims and deduplicates emoji tags. Like reactions, tags are short tokens without
+// whitespace; at least one is required.
+func normalizeStickerEmojis(emojis []string) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool)
+	for _, e := range emojis {
+		e = strings.TrimSpace(e)
+		if e == "" || seen[e] {
+			continue
+		}
+		if !validReaction(e) {
+			return nil, fmt.Errorf("%w: bad emoji tag %q", ErrInvalidSticker, e)
+		}
+		seen[e] = true
+		out = append(out, e)
+	}
+	if len(out) == 0 || len(out) > maxStickerEmojis {
+		return nil, fmt.Errorf("%w: a sticker needs 1 to %d emoji tags", ErrInvalidSticker, maxStickerEmojis)
+	}
+	return out, nil
+}
+
+// stickerPackAccessible is the condition under which the user (bound three times) may see the pack p: they own it,
+// installed it, or it was shared to one of their conversations.
+const stickerPackAccessible = `(p.owner_id = ?
+	OR EXISTS (SELECT 1 FROM installed_sticker_packs i WHERE i.pack_id = p.id AND i.user_id = ?)
+	OR EXISTS (SELECT 1 FROM sticker_pack_shares s JOIN group_members gm ON gm.group_id = s.conversation_id
+		WHERE s.pack_id = p.id AND gm.user_id = ?))`
+
+// CreateStickerPack creates an empty pack, installed for its owner.
+func (db *appdbimpl) CreateStickerPack(ownerID, name string) (StickerPack, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxStickerPackNameLength {
+		return StickerPack{}, fmt.Errorf("%w: pack name must be 1 to %d characters", ErrInvalidSticker, maxStickerPackNameLength)
+	}
+	id, err := GenerateNewID()
+	if err != nil {
+		return StickerPack{}, fmt.Errorf("GenerateNewID error: %w", err)
+	}
+	pack := StickerPack{
+		ID:        id,
+		OwnerID:   ownerID,
+		Name:      name,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Installed: true,
+		Stickers:  []Sticker{},
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return StickerPack{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", err)
+		}
+	}()
+	if _, err := tx.Exec("INSERT INTO sticker_packs (id, owner_id, name, created_at) VALUES (?, ?, ?, ?)",
+		pack.ID, pack.OwnerID, pack.Name, pack.CreatedAt); err != nil {
+		return StickerPack{}, fmt.Errorf("failed to create sticker pack: %w", err)
+	}
+	if _, err := tx.Exec("INSERT INTO installed_sticker_packs (user_id, pack_id, installed_at) VALUES (?, ?, ?)",
+		ownerID, pack.ID, pack.CreatedAt); err != nil {
+		return StickerPack{}, fmt.Errorf("failed to install sticker pack: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return StickerPack{}, fmt.Errorf("failed to commit sticker pack: %w", err)
+	}
+	return pack, nil
+}
+
+// GetStickerPack returns a pack with its stickers, if the user may see it.
+func (db *appdbimpl) GetStickerPack(packID, userID string) (StickerPack, error) {
+	packs, err := db.queryStickerPacks("p.id = ? AND "+stickerPackAccessible, userID, packID, userID, userID, userID)
+	if err != nil {
+		return StickerPack{}, err
+	}
+	if len(packs) == 0 {
+		return StickerPack{}, ErrStickerPackNotFound
+	}
+	return packs[0], nil
+}
+
+// GetInstalledStickerPacks returns the packs the user installed, oldest first.
+func (db *appdbimpl) GetInstalledStickerPacks(userID string) ([]StickerPack, error) {
+	return db.queryStickerPacks("p.id IN (SELECT pack_id FROM installed_sticker_packs WHERE user_id = ?)", userID, userID)
+}
+
+// GetSharedStickerPacks returns the packs shared to a conversation the user is a member of.
+func (db *appdbimpl) GetSharedStickerPacks(conversationID, userID string) ([]StickerPack, error) {
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return nil, err
+	}
+	return db.queryStickerPacks("p.id IN (SELECT pack_id FROM sticker_pack_shares WHERE conversation_id = ?)", userID, conversationID)
+}
+
+// queryStickerPacks returns the packs matching where, whose arguments follow userID, with their stickers.
+func (db *appdbimpl) queryStickerPacks(where, userID string, args ...interface{}) ([]StickerPack, error) {
+	rows, err := db.db.Query(`
+		SELECT p.id, p.owner_id, p.name, p.created_at,
+			EXISTS (SELECT 1 FROM installed_sticker_packs i WHERE i.pack_id = p.id AND i.user_id = ?)
+		FROM sticker_packs p
+		WHERE `+where+`
+		ORDER BY p.created_at, p.id`, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sticker packs: %w", err)
+	}
+	packs := []StickerPack{}
+	for rows.Next() {
+		p := StickerPack{Stickers: []Sticker{}}
+		if err := rows.Scan(&p.ID, &p.OwnerID, &p.Name, &p.CreatedAt, &p.Installed); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan sticker pack: %w", err)
+		}
+		packs = append(packs, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	for i := range packs {
+		stickers, err := db.queryStickers("s.pack_id = ?", -1, packs[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		packs[i].Stickers = stickers
+	}
+	return packs, nil
+}
+
+// queryStickers returns up to limit stickers matching where, oldest first, with their emoji tags. A negative limit
+// returns them all.
+func (db *appdbimpl) queryStickers(where string, limit int, args ...interface{}) ([]Sticker, error) {
+	rows, err := db.db.Query(`
+		SELECT s.id, s.pack_id, s.url, s.mime_type, s.created_at,
+			(SELECT json_group_array(e.emoji) FROM (SELECT emoji FROM sticker_emojis WHERE sticker_id = s.id ORDER BY position) e)
+		FROM stickers s
+		WHERE `+where+`
+		ORDER BY s.created_at, s.id
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stickers: %w", err)
+	}
+	defer rows.Close()
+
+	stickers := []Sticker{}
+	for rows.Next() {
+		var s Sticker
+		var emojis string
+		if err := rows.Scan(&s.ID, &s.PackID, &s.URL, &s.MimeType, &s.CreatedAt, &emojis); err != nil {
+			return nil, fmt.Errorf("failed to scan sticker: %w", err)
+		}
+		if err := json.Unmarshal([]byte(emojis), &s.Emojis); err != nil {
+			return nil, fmt.Errorf("failed to decode sticker emojis: %w", err)
+		}
+		stickers = append(stickers, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return stickers, nil
+}
+
+// checkPackOwner returns ErrStickerPackNotFound if the pack does not exist and ErrNotPackOwner if userID does not own it.
+func checkPackOwner(q dbtx, packID, userID string) error {
+	var ownerID string
+	err := q.QueryRow("SELECT owner_id FROM sticker_packs WHERE id = ?", packID).Scan(&ownerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrStickerPackNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to look up sticker pack: %w", err)
+	}
+	if ownerID != userID {
+		return ErrNotPackOwner
+	}
+	return nil
+}
+
+// AddSticker adds a sticker, whose file is already stored at s.URL, to one of the user's packs. The caller chooses
+// the ID, which names the stored file.
+func (db *appdbimpl) AddSticker(packID, userID string, s Sticker) (Sticker, error) {
+	emojis, err := normalizeStickerEmojis(s.Emojis)
+	if err != nil {
+		return Sticker{}, err
+	}
+	s.Emojis = emojis
+	s.PackID = packID
+	s.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return Sticker{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", err)
+		}
+	}()
+
+	if err := checkPackOwner(tx, packID, userID); err != nil {
+		return Sticker{}, err
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM stickers WHERE pack_id = ?", packID).Scan(&count); err != nil {
+		return Sticker{}, fmt.Errorf("failed to count stickers: %w", err)
+	}
+	if count >= MaxStickersPerPack {
+		return Sticker{}, fmt.Errorf("%w: a pack holds at most %d stickers", ErrInvalidSticker, MaxStickersPerPack)
+	}
+
+	if _, err := tx.Exec("INSERT INTO stickers (id, pack_id, url, mime_type, created_at) VALUES (?, ?, ?, ?, ?)",
+		s.ID, s.PackID, s.URL, s.MimeType, s.CreatedAt); err != nil {
+		return Sticker{}, fmt.Errorf("failed to add sticker: %w", err)
+	}
+	for i, e := range s.Emojis {
+		if _, err := tx.Exec("INSERT INTO sticker_emojis (sticker_id, emoji, position) VALUES (?, ?, ?)", s.ID, e, i); err != nil {
+			return Sticker{}, fmt.Errorf("failed to tag sticker: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Sticker{}, fmt.Errorf("failed to commit sticker: %w", err)
+	}
+	return s, nil
+}
+
+// DeleteSticker removes a sticker from one of the user's packs. Messages already sent keep showing it.
+func (db *appdbimpl) DeleteSticker(packID, stickerID, userID string) error {
+	if err := checkPackOwner(db.db, packID, userID); err != nil {
+		return err
+	}
+	res, err := db.db.Exec("DELETE FROM stickers WHERE id = ? AND pack_id = ?", stickerID, packID)
+	if err != nil {
+		return fmt.Errorf("failed to delete sticker: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete sticker: %w", err)
+	}
+	if affected == 0 {
+		return ErrStickerNotFound
+	}
+	return nil
+}
+
+// InstallStickerPack adds a pack the user may see to their installed packs. Installing it again does nothing.
+func (db *appdbimpl) InstallStickerPack(packID, userID string) error {
+	res, err := db.db.Exec(`INSERT INTO installed_sticker_packs (user_id, pack_id, installed_at)
+		SELECT ?, p.id, ? FROM sticker_packs p WHERE p.id = ? AND `+stickerPackAccessible+`
+		ON CONFLICT (user_id, pack_id) DO NOTHING`,
+		userID, time.Now().UTC().Format(time.RFC3339), packID, userID, userID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to install sticker pack: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to install sticker pack: %w", err)
+	}
+	if affected == 0 {
+		// Either already installed or not accessible.
+		var installed bool
+		err := db.db.QueryRow("SELECT EXISTS (SELECT 1 FROM installed_sticker_packs WHERE user_id = ? AND pack_id = ?)",
+			userID, packID).Scan(&installed)
+		if err != nil {
+			return fmt.Errorf("failed to look up sticker pack: %w", err)
+		}
+		if !installed {
+			return ErrStickerPackNotFound
+		}
+	}
+	return nil
+}
+
+// UninstallStickerPack removes a pack from the user's installed packs.
+func (db *appdbimpl) UninstallStickerPack(packID, userID string) error {
+	res, err := db.db.Exec("DELETE FROM installed_sticker_packs WHERE user_id = ? AND pack_id = ?", userID, packID)
+	if err != nil {
+		return fmt.Errorf("failed to uninstall sticker pack: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to uninstall sticker pack: %w", err)
+	}
+	if affected == 0 {
+		return ErrStickerPackNotFound
+	}
+	return nil
+}
+
+// ShareStickerPack makes a pack the user may see available to the members of one of their conversations.
+func (db *appdbimpl) ShareStickerPack(packID, conversationID, userID string) error {
+	if err := db.checkMember(conversationID, userID); err != nil {
+		return err
+	}
+	var accessible bool
+	err := db.db.QueryRow("SELECT EXISTS (SELECT 1 FROM sticker_packs p WHERE p.id = ? AND "+stickerPackAccessible+")",
+		packID, userID, userID, userID).Scan(&accessible)
+	if err != nil {
+		return fmt.Errorf("failed to look up sticker pack: %w", err)
+	}
+	if !accessible {
+		return ErrStickerPackNotFound
+	}
+	_, err = db.db.Exec(`INSERT INTO sticker_pack_shares (pack_id, conversation_id, shared_by, shared_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (pack_id, conversation_id) DO NOTHING`,
+		packID, conversationID, userID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to share sticker pack: %w", err)
+	}
+	return nil
+}
+
+// SearchStickers returns up to limit stickers tagged with emoji in the packs the user installed.
+func (db *appdbimpl) SearchStickers(userID, emoji string, limit int) ([]Sticker, error) {
+	return db.queryStickers(`s.id IN (SELECT sticker_id FROM sticker_emojis WHERE emoji = ?)
+		AND s.pack_id IN (SELECT pack_id FROM installed_sticker_packs WHERE user_id = ?)`, limit, emoji, userID)
+}
+
+// resolveSticker fills the payload of a sticker message from the sticker it names, which must be in one of the
+// sender's installed packs. Whatever else the client sent in the payload is replaced.
+func resolveSticker(q dbtx, content *MessageContent, senderID string) error {
+	if content.Type != MessageTypeSticker {
+		return nil
+	}
+	var p StickerPayload
+	if err := decodePayload(content.Payload, &p); err != nil {
+		return err
+	}
+	if p.PackID == "" || p.StickerID == "" {
+		return fmt.Errorf("%w: sticker needs a pack and a sticker ID", ErrInvalidContent)
+	}
+	err := q.QueryRow(`
+		SELECT s.url, s.mime_type,
+			COALESCE((SELECT emoji FROM sticker_emojis WHERE sticker_id = s.id ORDER BY position LIMIT 1), '')
+		FROM stickers s
+		JOIN installed_sticker_packs i ON i.pack_id = s.pack_id AND i.user_id = ?
+		WHERE s.id = ? AND s.pack_id = ?`, senderID, p.StickerID, p.PackID).Scan(&p.URL, &p.MimeType, &p.Emoji)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrStickerNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to look up sticker: %w", err)
+	}
+	return content.encodePayload(p)
+}
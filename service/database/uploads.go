@@ -0,0 +1,269 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// Kinds of attachments beyond audio, see Attachment.
+const (
+	AttachmentKindImage = "image"
+	AttachmentKindFile  = "file"
+)
+
+const (
+	// maxOpenUploads is how many uploads a user may have in progress at once.
+	maxOpenUploads = 8
+
+	// maxStagedUploadBytes is the total size of the uploads a user may have in progress at once. The full size of
+	// an upload counts from its creation, since that is the disk space it may take.
+	maxStagedUploadBytes = 2 << 30
+)
+
+var (
+	// ErrUploadNotFound is returned when an upload does not exist or belongs to another user.
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadOffset is returned when a chunk does not start where the upload stopped, or the upload is
+	// finalized before all of it was received.
+	ErrUploadOffset = errors.New("upload offset mismatch")
+	// ErrInvalidUpload is returned for uploads with a bad name or size.
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrTooManyUploads is returned when a user starts an upload while having maxOpenUploads in progress.
+	ErrTooManyUploads = errors.New("too many uploads in progress")
+	// ErrUploadQuota is returned when an upload would take the uploads of a user in progress past
+	// maxStagedUploadBytes.
+	ErrUploadQuota = errors.New("upload quota exceeded")
+	// ErrAttachmentNotFound is returned when a message refers to an attachment that does not exist or was uploaded
+	// by another user.
+	ErrAttachmentNotFound = errors.New("attachment not found")
+)
+
+// Upload is a file being uploaded in chunks. Received counts the bytes stored so far.
+type Upload struct {
+	ID        string `json:"id"`
+	UserID    string `json:"userId"`
+	Filename  string `json:"filename"`
+	MimeType  string `json:"mimeType,omitempty"`
+	Size      int64  `json:"size"`
+	Received  int64  `json:"received"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// CreateUpload starts an upload of size bytes. It fails with ErrTooManyUploads or ErrUploadQuota if the user would
+// go past the limits on the uploads in progress; finalized, deleted and stale uploads no longer count.
+func (db *appdbimpl) CreateUpload(u Upload) (Upload, error) {
+	u.Filename = path.Base(strings.ReplaceAll(strings.TrimSpace(u.Filename), `\`, "/"))
+	if u.Filename == "." || u.Filename == "/" || len(u.Filename) > 255 {
+		return Upload{}, fmt.Errorf("%w: bad file name", ErrInvalidUpload)
+	}
+	if u.Size <= 0 {
+		return Upload{}, fmt.Errorf("%w: size must be positive", ErrInvalidUpload)
+	}
+	if u.MimeType != "" && (len(u.MimeType) > 127 || strings.Count(u.MimeType, "/") != 1 || strings.ContainsAny(u.MimeType, " \r\n;,")) {
+		return Upload{}, fmt.Errorf("%w: bad MIME type", ErrInvalidUpload)
+	}
+
+	id, err := GenerateNewID()
+	if err != nil {
+		return Upload{}, fmt.Errorf("GenerateNewID error: %w", err)
+	}
+	u.ID = id
+	u.Received = 0
+	u.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	u.UpdatedAt = u.CreatedAt
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return Upload{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", err)
+		}
+	}()
+
+	// The upload is inserted before the limits are checked: the insert takes the write lock, so concurrent
+	// requests of the user are checked one after the other.
+	_, err = tx.Exec(`INSERT INTO uploads (id, user_id, filename, mime_type, size, received, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?)`,
+		u.ID, u.UserID, u.Filename, u.MimeType, u.Size, u.CreatedAt, u.UpdatedAt)
+	if err != nil {
+		return Upload{}, fmt.Errorf("failed to create upload: %w", err)
+	}
+	var open, staged int64
+	err = tx.QueryRow("SELECT COUNT(*), COALESCE(SUM(size), 0) FROM uploads WHERE user_id = ?", u.UserID).
+		Scan(&open, &staged)
+	if err != nil {
+		return Upload{}, fmt.Errorf("failed to count uploads: %w", err)
+	}
+	if open > maxOpenUploads {
+		return Upload{}, fmt.Errorf("%w: at most %d at once", ErrTooManyUploads, maxOpenUploads)
+	}
+	if staged > maxStagedUploadBytes {
+		return Upload{}, fmt.Errorf("%w: uploads in progress may total at most %d bytes", ErrUploadQuota, int64(maxStagedUploadBytes))
+	}
+	if err := tx.Commit(); err != nil {
+		return Upload{}, fmt.Errorf("transaction commit failed: %w", err)
+	}
+	return u, nil
+}
+
+// GetUpload returns one of the user's uploads.
+func (db *appdbimpl) GetUpload(uploadID, userID string) (Upload, error) {
+	u := Upload{ID: uploadID, UserID: userID}
+	err := db.db.QueryRow(`SELECT filename, mime_type, size, received, created_at, updated_at
+		FROM uploads WHERE id = ? AND user_id = ?`, uploadID, userID).
+		Scan(&u.Filename, &u.MimeType, &u.Size, &u.Received, &u.CreatedAt, &u.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Upload{}, ErrUploadNotFound
+	} else if err != nil {
+		return Upload{}, fmt.Errorf("failed to get upload: %w", err)
+	}
+	return u, nil
+}
+
+// AdvanceUpload records that the bytes from offset from to offset to were stored. It fails with ErrUploadOffset if
+// the upload is no longer at from.
+func (db *appdbimpl) AdvanceUpload(uploadID string, from, to int64) error {
+	res, err := db.db.Exec("UPDATE uploads SET received = ?, updated_at = ? WHERE id = ? AND received = ? AND ? <= size",
+		to, time.Now().UTC().Format(time.RFC3339), uploadID, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to advance upload: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to advance upload: %w", err)
+	}
+	if affected == 0 {
+		return ErrUploadOffset
+	}
+	return nil
+}
+
+// CompleteUpload turns a fully received upload into an attachment, in one transaction.
+func (db *appdbimpl) CompleteUpload(uploadID string, a Attachment) (Attachment, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("tx.Rollback() error: %v", err)
+		}
+	}()
+
+	res, err := tx.Exec("DELETE FROM uploads WHERE id = ? AND user_id = ? AND received = size", uploadID, a.UploaderID)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to complete upload: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to complete upload: %w", err)
+	}
+	if affected == 0 {
+		return Attachment{}, ErrUploadOffset
+	}
+	a, err = insertAttachment(tx, a)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Attachment{}, fmt.Errorf("failed to commit upload: %w", err)
+	}
+	return a, nil
+}
+
+// DeleteUpload abandons one of the user's uploads.
+func (db *appdbimpl) DeleteUpload(uploadID, userID string) error {
+	res, err := db.db.Exec("DELETE FROM uploads WHERE id = ? AND user_id = ?", uploadID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	if affected == 0 {
+		return ErrUploadNotFound
+	}
+	return nil
+}
+
+// DeleteStaleUploads deletes the uploads not touched since before and returns their IDs.
+func (db *appdbimpl) DeleteStaleUploads(before time.Time) ([]string, error) {
+	cutoff := before.UTC().Format(time.RFC3339)
+	rows, err := db.db.Query("SELECT id FROM uploads WHERE updated_at < ?", cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale uploads: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan stale upload: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	for _, id := range ids {
+		if _, err := db.db.Exec("DELETE FROM uploads WHERE id = ? AND updated_at < ?", id, cutoff); err != nil {
+			return nil, fmt.Errorf("failed to delete stale upload: %w", err)
+		}
+	}
+	return ids, nil
+}
+
+// resolveAttachment fills content from the attachment it refers to, if any: the type follows the kind of the
+// attachment and the payload describes the file. Only the uploader may send an attachment. The body is kept as a
+// caption.
+func resolveAttachment(q dbtx, content *MessageContent, senderID string) error {
+	if content.AttachmentID == "" {
+		return nil
+	}
+	if len(content.Payload) > 0 || len(content.Entities) > 0 {
+		return fmt.Errorf("%w: a message with an attachment takes no payload or entities", ErrInvalidContent)
+	}
+
+	var a Attachment
+	var waveform sql.NullString
+	err := q.QueryRow(`SELECT kind, url, name, mime_type, size, duration_ms, waveform FROM attachments
+		WHERE id = ? AND uploader_id = ?`, content.AttachmentID, senderID).
+		Scan(&a.Kind, &a.URL, &a.Name, &a.MimeType, &a.Size, &a.DurationMs, &waveform)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAttachmentNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to look up attachment: %w", err)
+	}
+	if waveform.Valid {
+		if err := json.Unmarshal([]byte(waveform.String), &a.Waveform); err != nil {
+			log.Printf("failed to decode waveform of attachment %s: %v", content.AttachmentID, err)
+		}
+	}
+
+	var payload interface{}
+	switch a.Kind {
+	case AttachmentKindAudio:
+		content.Type = MessageTypeAudio
+		payload = AudioPayload{URL: a.URL, MimeType: a.MimeType, DurationMs: a.DurationMs, Waveform: a.Waveform}
+	case AttachmentKindImage:
+		content.Type = MessageTypeImage
+		payload = ImagePayload{URL: a.URL, MimeType: a.MimeType, Caption: content.Body}
+	default:
+		content.Type = MessageTypeFile
+		payload = FilePayload{URL: a.URL, Name: a.Name, Size: a.Size, MimeType: a.MimeType}
+	}
+	content.AttachmentID = ""
+	return content.encodePayload(payload)
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidCursor is returned for page cursors that ListUsers did not issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// userCursor is the position after the last user of a page of ListUsers. Users are listed in two passes, prefix
+// matches first and then fuzzy matches, each ordered by username and ID.
+type userCursor struct {
+	Fuzzy    bool   `json:"f,omitempty"`
+	Username string `json:"u"`
+	ID       string `json:"i"`
+}
+
+func (c userCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeUserCursor(s string) (userCursor, error) {
+	var c userCursor
+	if s == "" {
+		return c, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil || c.ID == "" {
+		return userCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ListUsers returns up to limit users whose username starts with query, followed by those whose username contains
+// the characters of query in order, ignoring ASCII case. An empty query lists everyone. viewerID is left out, and so
+// are the users they blocked and those who blocked them. The second result is the cursor of the next page, or "" after
+// the last page.
+func (db *appdbimpl) ListUsers(viewerID, query string, limit int, cursor string) ([]User, string, error) {
+	after, err := decodeUserCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	query = strings.TrimSpace(query)
+
+	passes := []bool{false}
+	if query != "" {
+		passes = append(passes, true)
+	}
+	users := []User{}
+	var last userCursor
+	for _, fuzzy := range passes {
+		if after.Fuzzy && !fuzzy {
+			continue
+		}
+		from := userCursor{}
+		if after.Fuzzy == fuzzy {
+			from = after
+		}
+		// Fetch one user more than the page holds to learn whether there is a next page.
+		page, err := db.queryUserPage(viewerID, query, fuzzy, from, limit+1-len(users))
+		if err != nil {
+			return nil, "", err
+		}
+		for _, u := range page {
+			if len(users) == limit {
+				return users, last.encode(), nil
+			}
+			users = append(users, u)
+			last = userCursor{Fuzzy: fuzzy, Username: u.Username, ID: u.ID}
+		}
+	}
+	return users, "", nil
+}
+
+// queryUserPage returns up to limit users after the cursor from in one pass of ListUsers. Prefix matches are a range
+// of the username index; fuzzy matches leave them out.
+func (db *appdbimpl) queryUserPage(viewerID, query string, fuzzy bool, from userCursor, limit int) ([]User, error) {
+	where := `u.id != ?
+		AND u.id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = ?)
+		AND u.id NOT IN (SELECT blocker_id FROM user_blocks WHERE blocked_id = ?)`
+	args := []interface{}{viewerID, viewerID, viewerID, viewerID, viewerID, viewerID, viewerID}
+	if query != "" {
+		prefix := "u.username >= ? COLLATE NOCASE AND u.username < ? COLLATE NOCASE"
+		if fuzzy {
+			where += " AND u.username LIKE ? ESCAPE '\\' AND NOT (" + prefix + ")"
+			args = append(args, fuzzyPattern(query))
+		} else {
+			where += " AND " + prefix
+		}
+		args = append(args, query, query+string(utf8.MaxRune))
+	}
+	if from.ID != "" {
+		where += " AND (u.username > ? COLLATE NOCASE OR (u.username = ? COLLATE NOCASE AND u.id > ?))"
+		args = append(args, from.Username, from.Username, from.ID)
+	}
+
+	rows, err := db.db.Query(`SELECT u.id, u.username,
+			`+visiblePhoto+`,
+			CASE WHEN `+visibleTo("last_seen_visibility")+` THEN u.last_seen_at END
+		FROM users u
+		WHERE `+where+`
+		ORDER BY u.username COLLATE NOCASE, u.id
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.PhotoUrl, &user.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return users, nil
+}
+
+// fuzzyPattern returns the LIKE pattern matching the strings that contain the characters of query in order, such as
+// "%j%d%o%" for "jdo".
+func fuzzyPattern(query string) string {
+	var b strings.Builder
+	b.WriteByte('%')
+	for _, r := range query {
+		if r == '%' || r == '_' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+		b.WriteByte('%')
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestDecodeUserCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+		want   userCursor
+		err    error
+	}{
+		{name: "first page", cursor: ""},
+		{name: "prefix pass", cursor: userCursor{Username: "alice", ID: "1"}.encode(), want: userCursor{Username: "alice", ID: "1"}},
+		{name: "fuzzy pass", cursor: userCursor{Fuzzy: true, Username: "bob", ID: "2"}.encode(), want: userCursor{Fuzzy: true, Username: "bob", ID: "2"}},
+		{name: "not base64", cursor: "not a cursor!", err: ErrInvalidCursor},
+		{name: "padded base64", cursor: base64.URLEncoding.EncodeToString([]byte(`{"u":"a","i":"1"}`)), err: ErrInvalidCursor},
+		{name: "not JSON", cursor: base64.RawURLEncoding.EncodeToString([]byte("alice")), err: ErrInvalidCursor},
+		{name: "wrong field type", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"u":1,"i":"1"}`)), err: ErrInvalidCursor},
+		{name: "without ID", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"u":"alice"}`)), err: ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeUserCursor(tt.cursor)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("decodeUserCursor(%q) error = %v, want %v", tt.cursor, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeUserCursor(%q) = %+v, want %+v", tt.cursor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuzzyPattern(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "jdo", want: "%j%d%o%"},
+		{query: "a_b", want: `%a%\_%b%`},
+		{query: `5%\`, want: `%5%\%%\\%`},
+		{query: "né", want: "%n%é%"},
+	}
+	for _, tt := range tests {
+		if got := fuzzyPattern(tt.query); got != tt.want {
+			t.Errorf("fuzzyPattern(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+/*
+Package markup parses the small Markdown-like syntax messages may be written in into plain text and a list of
+formatting entities. Clients render the entities over the text themselves, so no markup, and in particular no HTML,
+is ever stored in a message.
+
+The syntax is
+
+	**bold**  *italic* or _italic_  ~~strike~~  `code`  [text](https://example.com)
+
+	```language
+	preformatted block
+	```
+
+A backslash escapes the next markup character. Markers without a matching closer, or enclosing text that starts or
+ends with a space, are kept as text.
+*/
+package markup
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Entity types.
+const (
+	Bold   = "bold"
+	Italic = "italic"
+	Strike = "strike"
+	Code   = "code"
+	Pre    = "pre"
+	Link   = "link"
+)
+
+// MaxEntities is the maximum number of entities of a message.
+const MaxEntities = 100
+
+// maxURLLength is the maximum length of a link target.
+const maxURLLength = 2048
+
+// maxLanguageLength is the maximum length of the language of a preformatted block.
+const maxLanguageLength = 20
+
+// ErrInvalidEntities is returned by Validate.
+var ErrInvalidEntities = errors.New("invalid formatting entities")
+
+// Entity formats a range of a message's text. Offset and Length count UTF-16 code units, like string indexes in
+// JavaScript. Entities may nest but code and pre entities contain no others.
+type Entity struct {
+	Type     string `json:"type"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	URL      string `json:"url,omitempty"`      // Links only
+	Language string `json:"language,omitempty"` // Preformatted blocks only
+}
+
+// escapable are the characters a backslash escapes.
+const escapable = "\\*_~`[]()"
+
+// Parse converts src to plain text and the entities formatting it.
+func Parse(src string) (string, []Entity) {
+	p := newParser([]rune(src))
+	p.inline(p.src, 0)
+	if len(p.entities) > MaxEntities {
+		p.entities = p.entities[:MaxEntities]
+	}
+	return p.out.String(), p.entities
+}
+
+// parser accumulates the text and entities produced from the source.
+type parser struct {
+	src      []rune
+	escaped  []bool // Whether each rune of src follows an escaping backslash
+	next     map[closer][]int
+	links    map[[2]int]string // Valid link targets between the given runes, or "" if invalid
+	out      strings.Builder
+	length   int // Length of out in UTF-16 code units
+	entities []Entity
+}
+
+// closer identifies a kind of search done by find.
+type closer struct {
+	marker   string
+	flanking bool
+}
+
+func newParser(src []rune) *parser {
+	p := &parser{src: src, escaped: make([]bool, len(src)), next: map[closer][]int{}, links: map[[2]int]string{}}
+	for j := 0; j < len(src); j++ {
+		if src[j] == '\\' && j+1 < len(src) {
+			j++
+			p.escaped[j] = true
+		}
+	}
+	return p
+}
+
+func (p *parser) emit(r rune) {
+	p.out.WriteRune(r)
+	p.length += len(utf16.Encode([]rune{r}))
+}
+
+func (p *parser) emitAll(rs []rune) {
+	for _, r := range rs {
+		p.emit(r)
+	}
+}
+
+// wrap emits the output of body inside entity e, dropping the entity if body emits nothing.
+func (p *parser) wrap(e Entity, body func()) {
+	e.Offset = p.length
+	index := len(p.entities)
+	p.entities = append(p.entities, e)
+	body()
+	if e.Length = p.length - e.Offset; e.Length == 0 {
+		p.entities = append(p.entities[:index], p.entities[index+1:]...)
+		return
+	}
+	p.entities[index].Length = e.Length
+}
+
+// inline parses src, which may contain any markup. Here and below, off is the index of src in the whole source.
+func (p *parser) inline(src []rune, off int) {
+	for i := 0; i < len(src); {
+		if n := p.markup(src, off, i); n > 0 {
+			i += n
+			continue
+		}
+		if src[i] == '\\' && i+1 < len(src) && strings.ContainsRune(escapable, src[i+1]) {
+			p.emit(src[i+1])
+			i += 2
+			continue
+		}
+		p.emit(src[i])
+		i++
+	}
+}
+
+// markup parses the construct starting at src[i], if any, and returns the number of runes it consumed.
+func (p *parser) markup(src []rune, off, i int) int {
+	switch {
+	case hasPrefix(src, i, "```"):
+		end := p.find(src, off, i+3, "```", false)
+		if end < 0 {
+			return 0
+		}
+		language, body := splitLanguage(src[i+3 : end])
+		if len(body) == 0 {
+			return 0
+		}
+		p.wrap(Entity{Type: Pre, Language: language}, func() { p.emitAll(body) })
+		return end + 3 - i
+
+	case src[i] == '`':
+		end := p.find(src, off, i+1, "`", false)
+		if end <= i+1 {
+			return 0
+		}
+		p.wrap(Entity{Type: Code}, func() { p.emitAll(src[i+1 : end]) })
+		return end + 1 - i
+
+	case src[i] == '[':
+		return p.link(src, off, i)
+	}
+
+	for _, m := range []struct{ marker, typ string }{
+		{"**", Bold}, {"~~", Strike}, {"*", Italic}, {"_", Italic},
+	} {
+		if !hasPrefix(src, i, m.marker) {
+			continue
+		}
+		// Single markers inside words, as in snake_case or 2*3*4, are not markup.
+		single := len(m.marker) == 1
+		if single && i > 0 && isWordRune(src[i-1]) {
+			return 0
+		}
+		start := i + len(m.marker)
+		end := p.find(src, off, start, m.marker, true)
+		if end < 0 || (single && end+1 < len(src) && isWordRune(src[end+1])) {
+			return 0
+		}
+		p.wrap(Entity{Type: m.typ}, func() { p.inline(src[start:end], off+start) })
+		return end + len(m.marker) - i
+	}
+	return 0
+}
+
+// link parses [text](url) at src[i].
+func (p *parser) link(src []rune, off, i int) int {
+	closeText := p.find(src, off, i+1, "](", false)
+	if closeText <= i+1 {
+		return 0
+	}
+	closeURL := p.find(src, off, closeText+2, ")", false)
+	if closeURL < 0 || closeURL-closeText-2 > maxURLLength {
+		return 0
+	}
+	// A run of brackets before the same link would otherwise check its target once per bracket.
+	key := [2]int{off + closeText, off + closeURL}
+	target, ok := p.links[key]
+	if !ok {
+		if target = strings.TrimSpace(string(src[closeText+2 : closeURL])); !validURL(target) {
+			target = ""
+		}
+		p.links[key] = target
+	}
+	if target == "" {
+		return 0
+	}
+	p.wrap(Entity{Type: Link, URL: target}, func() { p.inline(src[i+1:closeText], off+i+1) })
+	return closeURL + 1 - i
+}
+
+// find returns the index of the first unescaped occurrence of marker in src at or after from, or -1. If flanking is
+// set, the enclosed text must be non-empty and must not start or end with a space.
+//
+// The occurrences are looked up in a table built once per search kind over the whole source, so that parsing stays
+// linear however many unmatched markers the source holds.
+func (p *parser) find(src []rune, off, from int, marker string, flanking bool) int {
+	if flanking {
+		if from >= len(src) || unicode.IsSpace(src[from]) {
+			return -1
+		}
+		from++
+	}
+	if from > len(src) {
+		return -1
+	}
+	j := p.occurrences(closer{marker, flanking})[off+from]
+	if j < 0 || j+len(marker) > off+len(src) {
+		return -1
+	}
+	return j - off
+}
+
+// occurrences returns, for each index of the source, the index of the next occurrence of c at or after it, or -1.
+func (p *parser) occurrences(c closer) []int {
+	if next, ok := p.next[c]; ok {
+		return next
+	}
+	next := make([]int, len(p.src)+1)
+	next[len(p.src)] = -1
+	for j := len(p.src) - 1; j >= 0; j-- {
+		next[j] = next[j+1]
+		if p.closes(j, c) {
+			next[j] = j
+		}
+	}
+	p.next[c] = next
+	return next
+}
+
+// closes reports whether c occurs at src[j].
+func (p *parser) closes(j int, c closer) bool {
+	if p.escaped[j] || !hasPrefix(p.src, j, c.marker) {
+		return false
+	}
+	if !c.flanking {
+		return true
+	}
+	if j == 0 || unicode.IsSpace(p.src[j-1]) {
+		return false
+	}
+	// A single marker character must not be part of a doubled one, as in *a **b** c*.
+	if len(c.marker) == 1 {
+		m := rune(c.marker[0])
+		if hasPrefix(p.src, j+1, c.marker) || (p.src[j-1] == m && !p.escaped[j-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLanguage separates the optional language name on the first line of a preformatted block from its body, and
+// drops the newlines framing the body.
+func splitLanguage(block []rune) (string, []rune) {
+	var language string
+	for j, r := range block {
+		if r == '\n' {
+			if candidate := string(block[:j]); isLanguage(candidate) {
+				language = candidate
+			}
+			if language != "" || j == 0 {
+				block = block[j+1:]
+			}
+			break
+		}
+		if j >= maxLanguageLength {
+			break
+		}
+	}
+	if n := len(block); n > 0 && block[n-1] == '\n' {
+		block = block[:n-1]
+	}
+	return language, block
+}
+
+func isLanguage(s string) bool {
+	if s == "" || len(s) > maxLanguageLength {
+		return false
+	}
+	for _, r := range s {
+		if !isWordRune(r) && !strings.ContainsRune("+#.-", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasPrefix(src []rune, i int, prefix string) bool {
+	for _, r := range prefix {
+		if i >= len(src) || src[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// validURL accepts absolute http, https and mailto URLs.
+func validURL(s string) bool {
+	if len(s) > maxURLLength {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+// Validate checks that entities are well formed and fit text.
+func Validate(text string, entities []Entity) error {
+	if len(entities) > MaxEntities {
+		return fmt.Errorf("%w: more than %d entities", ErrInvalidEntities, MaxEntities)
+	}
+	length := len(utf16.Encode([]rune(text)))
+	for _, e := range entities {
+		if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > length {
+			return fmt.Errorf("%w: %s entity out of range", ErrInvalidEntities, e.Type)
+		}
+		switch e.Type {
+		case Bold, Italic, Strike, Code:
+			if e.URL != "" || e.Language != "" {
+				return fmt.Errorf("%w: unexpected attributes on %s entity", ErrInvalidEntities, e.Type)
+			}
+		case Pre:
+			if e.URL != "" || (e.Language != "" && !isLanguage(e.Language)) {
+				return fmt.Errorf("%w: invalid pre entity", ErrInvalidEntities)
+			}
+		case Link:
+			if !validURL(e.URL) || e.Language != "" {
+				return fmt.Errorf("%w: invalid link", ErrInvalidEntities)
+			}
+		default:
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidEntities, e.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package markup
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		text     string
+		entities []Entity
+	}{
+		{name: "plain", src: "hello", text: "hello"},
+		{name: "bold", src: "a **b** c", text: "a b c", entities: []Entity{{Type: Bold, Offset: 2, Length: 1}}},
+		{name: "italic", src: "*a* _b_", text: "a b",
+			entities: []Entity{{Type: Italic, Offset: 0, Length: 1}, {Type: Italic, Offset: 2, Length: 1}}},
+		{name: "strike", src: "~~gone~~", text: "gone", entities: []Entity{{Type: Strike, Offset: 0, Length: 4}}},
+		{name: "nested", src: "**bold *both* bold**", text: "bold both bold",
+			entities: []Entity{{Type: Bold, Offset: 0, Length: 14}, {Type: Italic, Offset: 5, Length: 4}}},
+		{name: "italic around bold", src: "*a **b** c*", text: "a b c",
+			entities: []Entity{{Type: Italic, Offset: 0, Length: 5}, {Type: Bold, Offset: 2, Length: 1}}},
+		{name: "code holds no markup", src: "`**x**`", text: "**x**", entities: []Entity{{Type: Code, Offset: 0, Length: 5}}},
+		{name: "pre with language", src: "```go\nfmt.Println()\n```", text: "fmt.Println()",
+			entities: []Entity{{Type: Pre, Offset: 0, Length: 13, Language: "go"}}},
+		{name: "pre without language", src: "```\n*x*\n```", text: "*x*", entities: []Entity{{Type: Pre, Offset: 0, Length: 3}}},
+		{name: "link", src: "see [the **docs**](https://example.com/d)", text: "see the docs",
+			entities: []Entity{{Type: Link, Offset: 4, Length: 8, URL: "https://example.com/d"}, {Type: Bold, Offset: 8, Length: 4}}},
+		{name: "link with bad scheme", src: "[x](javascript:alert(1))", text: "[x](javascript:alert(1))"},
+		{name: "unterminated bold", src: "**open", text: "**open"},
+		{name: "unterminated code", src: "`open", text: "`open"},
+		{name: "unterminated pre", src: "```open", text: "```open"},
+		{name: "unterminated link", src: "[text](https://example.com", text: "[text](https://example.com"},
+		{name: "empty markers", src: "**** ``", text: "**** ``"},
+		{name: "space inside markers", src: "* a * and ** b **", text: "* a * and ** b **"},
+		{name: "marker inside word", src: "snake_case_name and 2*3*4", text: "snake_case_name and 2*3*4"},
+		{name: "escaped markers", src: `\*not italic\* \[x\](y) \\`, text: `*not italic* [x](y) \`},
+		{name: "escaped closer", src: `*a\*b*`, text: "a*b", entities: []Entity{{Type: Italic, Offset: 0, Length: 3}}},
+		{name: "backslash before plain character", src: `a\b`, text: `a\b`},
+		{name: "offsets count UTF-16 units", src: "😀 **é😀**", text: "😀 é😀",
+			entities: []Entity{{Type: Bold, Offset: 3, Length: 3}}},
+		// Unmatched markers used to be searched for to the end of the source each, taking seconds on these.
+		{name: "long run of brackets", src: strings.Repeat("[", 100000), text: strings.Repeat("[", 100000)},
+		{name: "long run of brackets before a link", src: strings.Repeat("[", 100000) + "x](https://example.com)",
+			text: strings.Repeat("[", 99999) + "x", entities: []Entity{{Type: Link, Offset: 0, Length: 100000, URL: "https://example.com"}}},
+		{name: "long run of underscores", src: strings.Repeat("_", 100000), text: strings.Repeat("_", 100000)},
+		{name: "long run of stars", src: strings.Repeat("*", 100000), text: strings.Repeat("*", 20000), entities: boldRunes(MaxEntities)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Parse(tt.src)
+			if text != tt.text {
+				t.Errorf("Parse(%q) text = %q, want %q", tt.src, text, tt.text)
+			}
+			if !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("Parse(%q) entities = %+v, want %+v", tt.src, entities, tt.entities)
+			}
+			if err := Validate(text, entities); err != nil {
+				t.Errorf("Validate(Parse(%q)) error = %v", tt.src, err)
+			}
+		})
+	}
+}
+
+// boldRunes returns n entities making each of the first n characters bold.
+func boldRunes(n int) []Entity {
+	entities := make([]Entity, n)
+	for i := range entities {
+		entities[i] = Entity{Type: Bold, Offset: i, Length: 1}
+	}
+	return entities
+}
+
+func TestParseLimitsEntities(t *testing.T) {
+	_, entities := Parse(strings.Repeat("*a* ", MaxEntities+10))
+	if len(entities) != MaxEntities {
+		t.Errorf("len(entities) = %d, want %d", len(entities), MaxEntities)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []Entity
+		valid    bool
+	}{
+		{name: "none", text: "abc", valid: true},
+		{name: "whole text", text: "abc", entities: []Entity{{Type: Bold, Offset: 0, Length: 3}}, valid: true},
+		{name: "UTF-16 length", text: "😀", entities: []Entity{{Type: Bold, Offset: 0, Length: 2}}, valid: true},
+		{name: "past UTF-16 length", text: "😀", entities: []Entity{{Type: Bold, Offset: 1, Length: 2}}},
+		{name: "past the end", text: "abc", entities: []Entity{{Type: Bold, Offset: 2, Length: 2}}},
+		{name: "negative offset", text: "abc", entities: []Entity{{Type: Bold, Offset: -1, Length: 1}}},
+		{name: "empty", text: "abc", entities: []Entity{{Type: Bold, Offset: 1, Length: 0}}},
+		{name: "unknown type", text: "abc", entities: []Entity{{Type: "underline", Offset: 0, Length: 1}}},
+		{name: "URL on bold", text: "abc", entities: []Entity{{Type: Bold, Offset: 0, Length: 1, URL: "https://example.com"}}},
+		{name: "link", text: "abc", entities: []Entity{{Type: Link, Offset: 0, Length: 1, URL: "mailto:a@example.com"}}, valid: true},
+		{name: "link without URL", text: "abc", entities: []Entity{{Type: Link, Offset: 0, Length: 1}}},
+		{name: "relative link", text: "abc", entities: []Entity{{Type: Link, Offset: 0, Length: 1, URL: "/x"}}},
+		{name: "pre language", text: "abc", entities: []Entity{{Type: Pre, Offset: 0, Length: 3, Language: "c++"}}, valid: true},
+		{name: "bad pre language", text: "abc", entities: []Entity{{Type: Pre, Offset: 0, Length: 3, Language: "a b"}}},
+		{name: "too many", text: "a", entities: make([]Entity, MaxEntities+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.text, tt.entities)
+			if tt.valid && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidEntities) {
+				t.Errorf("Validate() error = %v, want %v", err, ErrInvalidEntities)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Package mediagc deletes the stored files nothing refers to any more: replaced profile and group photos, the media of
+deleted messages and attachments that were uploaded but never sent.
+
+A file is collected when no reference to its URL is found in the database and it is older than a grace period, which
+covers files just written whose reference is not stored yet. The collector runs periodically in the web API and on
+demand with the wasatext-admin command.
+*/
+package mediagc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/donnim1/WASAText/service/storage"
+)
+
+// DefaultGrace is the grace period used when Options.Grace is zero.
+const DefaultGrace = 24 * time.Hour
+
+// References tells which stored files are in use. It is implemented by database.AppDatabase.
+type References interface {
+	// ReferencedMediaURLs returns the URLs of the stored files in use.
+	ReferencedMediaURLs() (map[string]bool, error)
+	// ReleaseMedia checks the references again, in a way that keeps new ones from being added meanwhile, and calls
+	// remove for each of urls that is still unreferenced. It returns the URLs removed.
+	ReleaseMedia(urls []string, remove func(url string) error) ([]string, error)
+}
+
+// Options configures a collection.
+type Options struct {
+	// Grace is how old an unreferenced file must be to be deleted. Default DefaultGrace.
+	Grace time.Duration
+	// DryRun reports the files that would be deleted without deleting them.
+	DryRun bool
+	// Now is the current time. Default time.Now().
+	Now time.Time
+}
+
+// Report describes a collection.
+type Report struct {
+	Scanned    int            // Stored files examined
+	Referenced int            // Files in use
+	Recent     int            // Unreferenced files kept because they are within the grace period
+	Orphans    []storage.File // Files deleted, or that would be in a dry run
+	Bytes      int64          // Total size of Orphans
+	DryRun     bool
+}
+
+// String summarizes the report on one line.
+func (r Report) String() string {
+	verb := "deleted"
+	if r.DryRun {
+		verb = "would delete"
+	}
+	return fmt.Sprintf("scanned %d files: %d referenced, %d recent, %s %d (%d bytes)",
+		r.Scanned, r.Referenced, r.Recent, verb, len(r.Orphans), r.Bytes)
+}
+
+// Collect deletes from store the files refs does not refer to and that are older than the grace period. A first pass
+// over the store picks the candidates; refs.ReleaseMedia then checks each of them again just before deleting it, so
+// that a file referenced in the meantime is kept. A failed deletion stops the collection; the report then lists the
+// files deleted so far.
+func Collect(refs References, store storage.Backend, opts Options) (Report, error) {
+	if opts.Grace <= 0 {
+		opts.Grace = DefaultGrace
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	cutoff := opts.Now.Add(-opts.Grace)
+
+	inUse, err := refs.ReferencedMediaURLs()
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{DryRun: opts.DryRun}
+	var candidates []storage.File
+	err = store.Walk(func(f storage.File) error {
+		report.Scanned++
+		switch {
+		case inUse[store.URL(f.Name)]:
+			report.Referenced++
+		case f.ModTime.After(cutoff):
+			report.Recent++
+		default:
+			candidates = append(candidates, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	if opts.DryRun {
+		report.Orphans = candidates
+		for _, f := range candidates {
+			report.Bytes += f.Size
+		}
+		return report, nil
+	}
+
+	byURL := make(map[string]storage.File, len(candidates))
+	urls := make([]string, 0, len(candidates))
+	for _, f := range candidates {
+		byURL[store.URL(f.Name)] = f
+		urls = append(urls, store.URL(f.Name))
+	}
+	removed, err := refs.ReleaseMedia(urls, func(url string) error {
+		return store.Delete(byURL[url].Name)
+	})
+	for _, url := range removed {
+		report.Orphans = append(report.Orphans, byURL[url])
+		report.Bytes += byURL[url].Size
+	}
+	if err == nil {
+		// The candidates kept were referenced in the meantime.
+		report.Referenced += len(candidates) - len(removed)
+	}
+	return report, err
+}
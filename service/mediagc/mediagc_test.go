@@ -0,0 +1,85 @@
+package mediagc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donnim1/WASAText/service/storage"
+)
+
+// fakeRefs refers to the URLs in inUse. The URLs in lateRefs are only referred to once ReleaseMedia runs, as when a
+// message using the file is sent while the store is walked.
+type fakeRefs struct {
+	inUse    map[string]bool
+	lateRefs map[string]bool
+}
+
+func (f *fakeRefs) ReferencedMediaURLs() (map[string]bool, error) {
+	return f.inUse, nil
+}
+
+func (f *fakeRefs) ReleaseMedia(urls []string, remove func(url string) error) ([]string, error) {
+	var removed []string
+	for _, url := range urls {
+		if f.inUse[url] || f.lateRefs[url] {
+			continue
+		}
+		if err := remove(url); err != nil {
+			return removed, err
+		}
+		removed = append(removed, url)
+	}
+	return removed, nil
+}
+
+func TestCollect(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * DefaultGrace)
+	store := storage.NewDir(t.TempDir(), "/media/")
+	files := map[string]time.Time{
+		"photos/used.jpg":   old,
+		"photos/orphan.jpg": old,
+		"audio/late.ogg":    old,
+		"audio/new.ogg":     now,
+	}
+	for name, modTime := range files {
+		if _, err := store.Put(name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(store.Root, filepath.FromSlash(name)), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refs := &fakeRefs{
+		inUse:    map[string]bool{store.URL("photos/used.jpg"): true},
+		lateRefs: map[string]bool{store.URL("audio/late.ogg"): true},
+	}
+
+	dry, err := Collect(refs, store, Options{DryRun: true, Now: now})
+	if err != nil {
+		t.Fatalf("Collect() dry run error = %v", err)
+	}
+	if len(dry.Orphans) != 2 {
+		t.Errorf("dry run Orphans = %v, want the orphan and the file referenced late", dry.Orphans)
+	}
+
+	report, err := Collect(refs, store, Options{Now: now})
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0].Name != "photos/orphan.jpg" {
+		t.Errorf("Orphans = %v, want only photos/orphan.jpg", report.Orphans)
+	}
+	if report.Scanned != 4 || report.Referenced != 2 || report.Recent != 1 {
+		t.Errorf("report = %s, want 4 scanned, 2 referenced, 1 recent", report)
+	}
+	for name := range files {
+		_, err := os.Stat(filepath.Join(store.Root, filepath.FromSlash(name)))
+		if deleted := os.IsNotExist(err); deleted != (name == "photos/orphan.jpg") {
+			t.Errorf("%s deleted = %v", name, deleted)
+		}
+	}
+}
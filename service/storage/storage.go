@@ -0,0 +1,136 @@
+/*
+Package storage keeps the files users upload: profile and group photos, audio and other attachments.
+
+The Backend interface is implemented by Dir, which stores files in a local directory that the web server exposes
+under a URL prefix.
+*/
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrInvalidName is returned for names that are empty, absolute or escape the storage root.
+var ErrInvalidName = errors.New("invalid file name")
+
+// Backend stores files under slash-separated names such as "audio/<id>.ogg".
+type Backend interface {
+	// Put stores the content of r under name, replacing any file with that name, and returns its size. A failed
+	// Put leaves no partial file behind.
+	Put(name string, r io.Reader) (int64, error)
+	// Delete removes a file. Deleting a missing file is not an error.
+	Delete(name string) error
+	// URL returns the address the file is served at.
+	URL(name string) string
+	// Walk calls fn for every stored file, stopping at the first error.
+	Walk(fn func(File) error) error
+}
+
+// File describes a stored file.
+type File struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Dir is a Backend storing files in a local directory.
+type Dir struct {
+	Root      string // Directory holding the files
+	URLPrefix string // URL path the directory is served at, ending with a slash
+}
+
+// NewDir returns a Dir rooted at root and served at urlPrefix.
+func NewDir(root, urlPrefix string) *Dir {
+	if !strings.HasSuffix(urlPrefix, "/") {
+		urlPrefix += "/"
+	}
+	return &Dir{Root: root, URLPrefix: urlPrefix}
+}
+
+// path returns the local path of a file, rejecting names that would leave the root.
+func (d *Dir) path(name string) (string, error) {
+	clean := path.Clean(name)
+	if name == "" || clean != name || path.IsAbs(name) || clean == "." || strings.HasPrefix(clean, "../") || clean == ".." {
+		return "", fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return filepath.Join(d.Root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the file to a temporary name in the same directory and renames it into place.
+func (d *Dir) Put(name string, r io.Reader) (int64, error) {
+	p, err := d.path(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return 0, fmt.Errorf("failed to write file: %w", err)
+	}
+	return n, nil
+}
+
+// Delete removes the file.
+func (d *Dir) Delete(name string) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// URL returns the URL prefix followed by the name.
+func (d *Dir) URL(name string) string {
+	return d.URLPrefix + name
+}
+
+// Walk lists the directory tree under the root. Files being written by Put are included, so that ones left behind
+// by a crash can be collected.
+func (d *Dir) Walk(fn func(File) error) error {
+	err := filepath.Walk(d.Root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == d.Root && errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Root, p)
+		if err != nil {
+			return err
+		}
+		return fn(File{Name: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+	return nil
+}
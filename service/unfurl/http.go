@@ -0,0 +1,159 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// HTTPOptions configures an HTTPUnfurler. Zero values select the defaults.
+type HTTPOptions struct {
+	// Timeout bounds a whole fetch, redirects included. Default 5s.
+	Timeout time.Duration
+	// MaxBytes is the maximum number of bytes of a page read looking for metadata. Default 512 KiB.
+	MaxBytes int64
+	// MaxRedirects is the maximum number of redirects followed. Default 3.
+	MaxRedirects int
+	// UserAgent is sent with each request.
+	UserAgent string
+}
+
+// HTTPUnfurler fetches previews over HTTP. It only connects to public unicast addresses, checked on the resolved IP of
+// every connection so that DNS cannot be used to reach internal hosts, and does not use proxies.
+type HTTPUnfurler struct {
+	client    *http.Client
+	maxBytes  int64
+	userAgent string
+}
+
+// NewHTTPUnfurler returns an HTTPUnfurler configured with opts.
+func NewHTTPUnfurler(opts HTTPOptions) *HTTPUnfurler {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 512 << 10
+	}
+	if opts.MaxRedirects <= 0 {
+		opts.MaxRedirects = 3
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = "WASAText-LinkPreview/1.0"
+	}
+
+	dialer := &net.Dialer{
+		Timeout: opts.Timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                  nil,
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    opts.Timeout,
+		ResponseHeaderTimeout:  opts.Timeout,
+		MaxResponseHeaderBytes: 64 << 10,
+		MaxIdleConns:           10,
+		IdleConnTimeout:        30 * time.Second,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", opts.MaxRedirects)
+			}
+			if err := checkURL(req.URL); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	return &HTTPUnfurler{client: client, maxBytes: opts.MaxBytes, userAgent: opts.UserAgent}
+}
+
+// Unfurl fetches rawURL and extracts its preview.
+func (u *HTTPUnfurler) Unfurl(ctx context.Context, rawURL string) (Preview, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return Preview{}, fmt.Errorf("%w: %v", ErrUnsupportedURL, err)
+	}
+	if err := checkURL(target); err != nil {
+		return Preview{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return Preview{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", u.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return Preview{}, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("failed to fetch %s: status %d", rawURL, resp.StatusCode)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return Preview{}, ErrNotHTML
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, u.maxBytes))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Preview{}, fmt.Errorf("failed to read %s: %w", rawURL, err)
+	}
+
+	p := parsePreview(string(body), resp.Request.URL)
+	if p.Title == "" && p.Description == "" {
+		return Preview{}, ErrNoPreview
+	}
+	return p, nil
+}
+
+// checkURL accepts absolute http and https URLs without credentials.
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q", ErrUnsupportedURL, u.Scheme)
+	}
+	if u.Host == "" || u.User != nil {
+		return ErrUnsupportedURL
+	}
+	if strings.EqualFold(u.Hostname(), "localhost") {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+// carrierGradeNAT is the shared address space of RFC 6598, which net.IP.IsPrivate does not cover.
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip is a global unicast address outside the private, loopback and link-local ranges.
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if ip4[0] == 0 || carrierGradeNAT.Contains(ip4) {
+			return false
+		}
+	}
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
@@ -0,0 +1,116 @@
+package unfurl
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Length limits applied to extracted text.
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 500
+	maxSiteNameLength    = 100
+)
+
+var (
+	metaTag   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attribute = regexp.MustCompile(`(?is)([a-z][a-z0-9:_-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	titleTag  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	linkTag   = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+)
+
+// parsePreview extracts the preview of a page fetched from base. OpenGraph properties win over Twitter cards and
+// plain HTML.
+func parsePreview(page string, base *url.URL) Preview {
+	meta := make(map[string]string)
+	for _, tag := range metaTag.FindAllString(page, -1) {
+		attrs := parseAttributes(tag)
+		key := strings.ToLower(attrs["property"])
+		if key == "" {
+			key = strings.ToLower(attrs["name"])
+		}
+		if _, seen := meta[key]; key != "" && !seen {
+			meta[key] = attrs["content"]
+		}
+	}
+
+	p := Preview{
+		URL:         base.String(),
+		Title:       firstOf(meta["og:title"], meta["twitter:title"]),
+		Description: firstOf(meta["og:description"], meta["twitter:description"], meta["description"]),
+		SiteName:    meta["og:site_name"],
+	}
+	if p.Title == "" {
+		if m := titleTag.FindStringSubmatch(page); m != nil {
+			p.Title = m[1]
+		}
+	}
+	if image := resolve(base, firstOf(meta["og:image"], meta["og:image:url"], meta["twitter:image"])); image != "" {
+		p.ImageURL = image
+	}
+	if canonical := resolve(base, firstOf(meta["og:url"], canonicalLink(page))); canonical != "" {
+		p.URL = canonical
+	}
+
+	p.Title = clean(p.Title, maxTitleLength)
+	p.Description = clean(p.Description, maxDescriptionLength)
+	p.SiteName = clean(p.SiteName, maxSiteNameLength)
+	return p
+}
+
+// parseAttributes returns the attributes of an HTML tag, with lower-case names and unescaped values.
+func parseAttributes(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attribute.FindAllStringSubmatch(tag, -1) {
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+	}
+	return attrs
+}
+
+// canonicalLink returns the href of the page's <link rel="canonical">, if any.
+func canonicalLink(page string) string {
+	for _, tag := range linkTag.FindAllString(page, -1) {
+		attrs := parseAttributes(tag)
+		if strings.EqualFold(attrs["rel"], "canonical") {
+			return attrs["href"]
+		}
+	}
+	return ""
+}
+
+// resolve resolves ref against base, returning "" unless the result is an http or https URL.
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+// clean unescapes s, collapses whitespace and truncates it to max bytes without splitting a character.
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	if len(s) <= max {
+		return s
+	}
+	s = s[:max]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
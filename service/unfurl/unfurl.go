@@ -0,0 +1,56 @@
+/*
+Package unfurl fetches link previews: the title, description and image a web page declares for itself through
+OpenGraph (or plain HTML) metadata.
+
+The Unfurler interface is implemented by HTTPUnfurler, which fetches pages from the internet, and by Stub, which
+returns canned previews.
+*/
+package unfurl
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrUnsupportedURL is returned for URLs that are not plain http or https links.
+	ErrUnsupportedURL = errors.New("unsupported URL")
+	// ErrBlockedAddress is returned when a URL resolves to a loopback, private or otherwise non-public address.
+	ErrBlockedAddress = errors.New("address not allowed")
+	// ErrNotHTML is returned when the URL does not point to an HTML page.
+	ErrNotHTML = errors.New("not an HTML page")
+	// ErrNoPreview is returned when the page has neither a title nor a description.
+	ErrNoPreview = errors.New("page has no preview metadata")
+)
+
+// Preview is the metadata of a web page.
+type Preview struct {
+	URL         string // Canonical URL of the page, or the fetched URL
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+// Unfurler fetches the preview of a URL.
+type Unfurler interface {
+	Unfurl(ctx context.Context, url string) (Preview, error)
+}
+
+// Stub is an Unfurler returning the previews in its map. URLs not in the map fail with Err, or ErrNoPreview if Err is
+// nil.
+type Stub struct {
+	Previews map[string]Preview
+	Err      error
+}
+
+// Unfurl returns the canned preview of url.
+func (s Stub) Unfurl(_ context.Context, url string) (Preview, error) {
+	if p, ok := s.Previews[url]; ok {
+		return p, nil
+	}
+	if s.Err != nil {
+		return Preview{}, s.Err
+	}
+	return Preview{}, ErrNoPreview
+}
@@ -0,0 +1,117 @@
+package unfurl
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{ip: "10.1.2.3", want: false},
+		{ip: "172.16.0.1", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "127.0.0.1", want: false},
+		{ip: "0.0.0.0", want: false},
+		{ip: "0.1.2.3", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "255.255.255.255", want: false},
+		{ip: "224.0.0.1", want: false},
+		{ip: "::1", want: false},
+		{ip: "::", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "ff02::1", want: false},
+		{ip: "::ffff:127.0.0.1", want: false},
+		{ip: "::ffff:10.0.0.1", want: false},
+		{ip: "::ffff:169.254.169.254", want: false},
+		{ip: "::ffff:93.184.216.34", want: true},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestParsePreview(t *testing.T) {
+	base, err := url.Parse("https://example.com/articles/1?ref=chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		page string
+		want Preview
+	}{
+		{
+			name: "OpenGraph",
+			page: `<html><head><title>HTML title</title>
+				<meta property="og:title" content="OG title">
+				<meta property="og:description" content='OG description'>
+				<meta property="og:image" content="/img/cover.png">
+				<meta property="og:site_name" content="Example">
+				<meta property="og:url" content="https://example.com/articles/1">
+				</head></html>`,
+			want: Preview{URL: "https://example.com/articles/1", Title: "OG title", Description: "OG description",
+				ImageURL: "https://example.com/img/cover.png", SiteName: "Example"},
+		},
+		{
+			name: "OpenGraph wins over Twitter cards",
+			page: `<meta name="twitter:title" content="Card title"><meta property="og:title" content="OG title">
+				<meta name="twitter:image" content="https://cdn.example.com/card.png">`,
+			want: Preview{URL: base.String(), Title: "OG title", ImageURL: "https://cdn.example.com/card.png"},
+		},
+		{
+			name: "plain HTML",
+			page: `<TITLE>Plain  &amp;
+				simple</TITLE><META NAME="Description" CONTENT="A page"><link rel="canonical" href="/articles/1">`,
+			want: Preview{URL: "https://example.com/articles/1", Title: "Plain & simple", Description: "A page"},
+		},
+		{
+			name: "first tag wins",
+			page: `<meta property="og:title" content="First"><meta property="og:title" content="Second">`,
+			want: Preview{URL: base.String(), Title: "First"},
+		},
+		{
+			name: "unquoted attributes",
+			page: `<meta property=og:title content=Unquoted>`,
+			want: Preview{URL: base.String(), Title: "Unquoted"},
+		},
+		{
+			name: "non-http image and canonical URL",
+			page: `<meta property="og:title" content="T"><meta property="og:image" content="javascript:alert(1)">
+				<meta property="og:url" content="ftp://example.com/">`,
+			want: Preview{URL: base.String(), Title: "T"},
+		},
+		{
+			name: "no metadata",
+			page: `<p>Nothing here</p>`,
+			want: Preview{URL: base.String()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parsePreview(tt.page, base); got != tt.want {
+				t.Errorf("parsePreview() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePreviewTruncates(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	title := strings.Repeat("é", maxTitleLength)
+	p := parsePreview(`<meta property="og:title" content="`+title+`">`, base)
+	if len(p.Title) > maxTitleLength || !strings.HasPrefix(title, p.Title) || p.Title == "" {
+		t.Errorf("parsePreview() title of %d bytes, want a prefix of at most %d bytes", len(p.Title), maxTitleLength)
+	}
+}
@@ -0,0 +1,322 @@
+/*
+Package vcard parses, validates and writes vCard 3.0 (RFC 2426) and 4.0 (RFC 6350) contact cards.
+
+Parse accepts a single card, unfolds its lines and checks its structure; it does not interpret every property, but
+keeps them all so that String writes the card back without losing data. Values are kept in their escaped form; use
+Card.Text for the text of properties such as FN or EMAIL.
+*/
+package vcard
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxSize is the maximum size of a card accepted by Parse, in bytes.
+const MaxSize = 16 * 1024
+
+// maxProperties is the maximum number of properties of a card.
+const maxProperties = 200
+
+// maxLineLength is the length at which String folds lines, in octets, as both RFCs recommend.
+const maxLineLength = 75
+
+// ErrInvalid is wrapped by the errors returned by Parse.
+var ErrInvalid = errors.New("invalid vCard")
+
+// Property is a content line of a card, such as TEL;TYPE=cell:+39 06 1234.
+type Property struct {
+	Group  string              // Optional group prefix, as in item1.TEL
+	Name   string              // Upper case
+	Params map[string][]string // Parameter names are upper case
+	Value  string              // Escaped as in the card
+}
+
+// Card is a parsed vCard. Properties do not include BEGIN, VERSION and END.
+type Card struct {
+	Version    string // "3.0" or "4.0"
+	Properties []Property
+}
+
+// New returns an empty card of the given version.
+func New(version string) *Card {
+	return &Card{Version: version}
+}
+
+// Add appends a text property, escaping value.
+func (c *Card) Add(name, value string) {
+	c.Properties = append(c.Properties, Property{Name: strings.ToUpper(name), Value: Escape(value)})
+}
+
+// AddRaw appends a property whose value is already escaped, like a URI.
+func (c *Card) AddRaw(name, value string, params map[string][]string) {
+	c.Properties = append(c.Properties, Property{Name: strings.ToUpper(name), Params: params, Value: value})
+}
+
+// Get returns the first property with the given name.
+func (c *Card) Get(name string) (Property, bool) {
+	name = strings.ToUpper(name)
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// Text returns the unescaped value of the first property with the given name, or "".
+func (c *Card) Text(name string) string {
+	p, ok := c.Get(name)
+	if !ok {
+		return ""
+	}
+	return Unescape(p.Value)
+}
+
+// Parse parses a single vCard.
+func Parse(s string) (*Card, error) {
+	if len(s) > MaxSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalid, MaxSize)
+	}
+	if !utf8.ValidString(s) {
+		return nil, fmt.Errorf("%w: not UTF-8", ErrInvalid)
+	}
+
+	lines := unfold(s)
+	if len(lines) < 2 || !strings.EqualFold(lines[0], "BEGIN:VCARD") || !strings.EqualFold(lines[len(lines)-1], "END:VCARD") {
+		return nil, fmt.Errorf("%w: must be a single BEGIN:VCARD ... END:VCARD block", ErrInvalid)
+	}
+	lines = lines[1 : len(lines)-1]
+	if len(lines) > maxProperties {
+		return nil, fmt.Errorf("%w: more than %d properties", ErrInvalid, maxProperties)
+	}
+
+	card := &Card{}
+	for _, line := range lines {
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "BEGIN", "END":
+			return nil, fmt.Errorf("%w: nested or multiple cards", ErrInvalid)
+		case "VERSION":
+			if card.Version != "" {
+				return nil, fmt.Errorf("%w: duplicate VERSION", ErrInvalid)
+			}
+			card.Version = p.Value
+		default:
+			card.Properties = append(card.Properties, p)
+		}
+	}
+
+	if card.Version != "3.0" && card.Version != "4.0" {
+		return nil, fmt.Errorf("%w: VERSION must be 3.0 or 4.0", ErrInvalid)
+	}
+	if strings.TrimSpace(card.Text("FN")) == "" {
+		return nil, fmt.Errorf("%w: missing FN", ErrInvalid)
+	}
+	return card, nil
+}
+
+// unfold splits a card into logical lines, joining continuation lines and dropping empty ones.
+func unfold(s string) []string {
+	raw := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	var lines []string
+	for _, l := range raw {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if strings.TrimSpace(l) != "" {
+			lines = append(lines, strings.TrimRight(l, "\r"))
+		}
+	}
+	return lines
+}
+
+// parseLine parses a content line: [group.]name[;param=value[,value]...]:value.
+func parseLine(line string) (Property, error) {
+	var p Property
+	colon := valueStart(line)
+	if colon < 0 {
+		return p, fmt.Errorf("%w: line without value: %.40q", ErrInvalid, line)
+	}
+	head, value := line[:colon], line[colon+1:]
+	for _, r := range value {
+		if unicode.IsControl(r) && r != '\t' {
+			return p, fmt.Errorf("%w: control character in value", ErrInvalid)
+		}
+	}
+	p.Value = value
+
+	parts := splitParams(head)
+	name := parts[0]
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		p.Group, name = name[:dot], name[dot+1:]
+		if !isName(p.Group) {
+			return p, fmt.Errorf("%w: bad group %q", ErrInvalid, p.Group)
+		}
+	}
+	if !isName(name) {
+		return p, fmt.Errorf("%w: bad property name %q", ErrInvalid, name)
+	}
+	p.Name = strings.ToUpper(name)
+
+	for _, param := range parts[1:] {
+		eq := strings.IndexByte(param, '=')
+		var key, val string
+		if eq < 0 {
+			// vCard 2.1-style bare parameters such as TEL;CELL are read as TYPE values.
+			key, val = "TYPE", param
+		} else {
+			key, val = param[:eq], param[eq+1:]
+		}
+		if !isName(key) {
+			return p, fmt.Errorf("%w: bad parameter name %q", ErrInvalid, key)
+		}
+		if p.Params == nil {
+			p.Params = make(map[string][]string)
+		}
+		key = strings.ToUpper(key)
+		for _, v := range splitValues(val) {
+			p.Params[key] = append(p.Params[key], strings.Trim(v, `"`))
+		}
+	}
+	return p, nil
+}
+
+// valueStart returns the index of the colon separating name and parameters from the value, skipping quoted
+// parameter values.
+func valueStart(line string) int {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitParams splits the part before the value on semicolons outside quotes.
+func splitParams(head string) []string {
+	return splitOutsideQuotes(head, ';')
+}
+
+// splitValues splits a parameter value list on commas outside quotes.
+func splitValues(val string) []string {
+	return splitOutsideQuotes(val, ',')
+}
+
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '-' || r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
+
+// String writes the card with CRLF line endings, folding long lines. Parameters are written in name order.
+func (c *Card) String() string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCARD\r\n")
+	writeFolded(&b, "VERSION:"+c.Version)
+	for _, p := range c.Properties {
+		var line strings.Builder
+		if p.Group != "" {
+			line.WriteString(p.Group + ".")
+		}
+		line.WriteString(p.Name)
+		keys := make([]string, 0, len(p.Params))
+		for k := range p.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			values := make([]string, len(p.Params[k]))
+			for i, v := range p.Params[k] {
+				if strings.ContainsAny(v, ":;,") {
+					v = `"` + v + `"`
+				}
+				values[i] = v
+			}
+			line.WriteString(";" + k + "=" + strings.Join(values, ","))
+		}
+		line.WriteString(":" + p.Value)
+		writeFolded(&b, line.String())
+	}
+	b.WriteString("END:VCARD\r\n")
+	return b.String()
+}
+
+// writeFolded writes a content line, folding it every maxLineLength octets without splitting UTF-8 sequences.
+func writeFolded(b *strings.Builder, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards their length.
+		limit = maxLineLength - 1
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// Escape escapes a text value.
+func Escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`)
+	return r.Replace(strings.ReplaceAll(s, "\r\n", "\n"))
+}
+
+// Unescape reverses Escape.
+func Unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
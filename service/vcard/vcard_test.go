@@ -0,0 +1,140 @@
+package vcard
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		card    string
+		version string
+		fn      string
+		props   int
+	}{
+		{name: "vCard 3.0", card: "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Ada Lovelace\r\nTEL;TYPE=cell:+44 20 1234\r\nEND:VCARD\r\n",
+			version: "3.0", fn: "Ada Lovelace", props: 2},
+		{name: "vCard 4.0 with LF endings", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada\nEND:VCARD", version: "4.0", fn: "Ada", props: 1},
+		{name: "lower case markers", card: "begin:vcard\nversion:4.0\nfn:Ada\nend:vcard", version: "4.0", fn: "Ada", props: 1},
+		{name: "folded line", card: "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Ada \r\n Love\r\n\tlace\r\nEND:VCARD\r\n",
+			version: "4.0", fn: "Ada Lovelace", props: 1},
+		{name: "escaped text", card: `BEGIN:VCARD` + "\n" + `VERSION:4.0` + "\n" + `FN:Smith\, John\; Jr.\nline` + "\n" + `END:VCARD`,
+			version: "4.0", fn: "Smith, John; Jr.\nline", props: 1},
+		{name: "blank lines", card: "BEGIN:VCARD\n\nVERSION:3.0\n\nFN:Ada\n\nEND:VCARD\n\n", version: "3.0", fn: "Ada", props: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := Parse(tt.card)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if card.Version != tt.version || card.Text("FN") != tt.fn || len(card.Properties) != tt.props {
+				t.Errorf("Parse() = version %s, FN %q, %d properties, want %s, %q, %d",
+					card.Version, card.Text("FN"), len(card.Properties), tt.version, tt.fn, tt.props)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		card string
+	}{
+		{name: "empty", card: ""},
+		{name: "no END", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada"},
+		{name: "two cards", card: "BEGIN:VCARD\nVERSION:4.0\nFN:A\nEND:VCARD\nBEGIN:VCARD\nVERSION:4.0\nFN:B\nEND:VCARD"},
+		{name: "nested card", card: "BEGIN:VCARD\nVERSION:4.0\nFN:A\nBEGIN:VCARD\nEND:VCARD"},
+		{name: "vCard 2.1", card: "BEGIN:VCARD\nVERSION:2.1\nFN:Ada\nEND:VCARD"},
+		{name: "no VERSION", card: "BEGIN:VCARD\nFN:Ada\nEND:VCARD"},
+		{name: "duplicate VERSION", card: "BEGIN:VCARD\nVERSION:4.0\nVERSION:4.0\nFN:Ada\nEND:VCARD"},
+		{name: "no FN", card: "BEGIN:VCARD\nVERSION:4.0\nN:Lovelace;Ada;;;\nEND:VCARD"},
+		{name: "blank FN", card: "BEGIN:VCARD\nVERSION:4.0\nFN: \nEND:VCARD"},
+		{name: "line without value", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada\nNOTE\nEND:VCARD"},
+		{name: "bad property name", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada\nX_NOTE:x\nEND:VCARD"},
+		{name: "bad group", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada\nitem 1.TEL:1\nEND:VCARD"},
+		{name: "bad parameter name", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada\nTEL;TY PE=cell:1\nEND:VCARD"},
+		{name: "control character", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada\x00\nEND:VCARD"},
+		{name: "not UTF-8", card: "BEGIN:VCARD\nVERSION:4.0\nFN:\xff\nEND:VCARD"},
+		{name: "too large", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada\nNOTE:" + strings.Repeat("x", MaxSize) + "\nEND:VCARD"},
+		{name: "too many properties", card: "BEGIN:VCARD\nVERSION:4.0\nFN:Ada\n" + strings.Repeat("NOTE:x\n", maxProperties) + "END:VCARD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.card); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Parse() error = %v, want %v", err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestParseProperties(t *testing.T) {
+	card, err := Parse("BEGIN:VCARD\nVERSION:3.0\nFN:Ada\nitem1.TEL;TYPE=cell,voice;pref:+1\n" +
+		"ADR;LABEL=\"1 Main St: Apt; 2\":;;1 Main St;;;;\nEND:VCARD")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	tel, ok := card.Get("tel")
+	if !ok {
+		t.Fatal("Get(tel) found nothing")
+	}
+	want := Property{Group: "item1", Name: "TEL", Params: map[string][]string{"TYPE": {"cell", "voice", "pref"}}, Value: "+1"}
+	if !reflect.DeepEqual(tel, want) {
+		t.Errorf("TEL = %+v, want %+v", tel, want)
+	}
+	adr, _ := card.Get("ADR")
+	if got := adr.Params["LABEL"]; len(got) != 1 || got[0] != "1 Main St: Apt; 2" || adr.Value != ";;1 Main St;;;;" {
+		t.Errorf("ADR = %+v, want the quoted label kept whole", adr)
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	card := New("4.0")
+	card.Add("FN", "Ada, Countess of Lovelace")
+	card.Add("NOTE", strings.Repeat("Analytical Engine ☃ ", 10)+"\nsecond line")
+	card.AddRaw("TEL", "tel:+44-20-1234", map[string][]string{"VALUE": {"uri"}, "TYPE": {"cell", "home;work"}})
+
+	s := card.String()
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\r\n"), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line of %d octets, longer than %d: %q", len(line), maxLineLength, line)
+		}
+	}
+	if !strings.Contains(s, "\r\nTEL;TYPE=cell,\"home;work\";VALUE=uri:tel:+44-20-1234\r\n") {
+		t.Errorf("String() = %q, want sorted and quoted parameters", s)
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(String()) error = %v", err)
+	}
+	if !reflect.DeepEqual(parsed, card) {
+		t.Errorf("Parse(String()) = %+v, want %+v", parsed, card)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		text    string
+		escaped string
+	}{
+		{text: "plain", escaped: "plain"},
+		{text: `a\b`, escaped: `a\\b`},
+		{text: "a,b;c", escaped: `a\,b\;c`},
+		{text: "one\r\ntwo\nthree", escaped: `one\ntwo\nthree`},
+	}
+	for _, tt := range tests {
+		if got := Escape(tt.text); got != tt.escaped {
+			t.Errorf("Escape(%q) = %q, want %q", tt.text, got, tt.escaped)
+		}
+		if got, want := Unescape(tt.escaped), strings.ReplaceAll(tt.text, "\r\n", "\n"); got != want {
+			t.Errorf("Unescape(%q) = %q, want %q", tt.escaped, got, want)
+		}
+	}
+	if got := Unescape(`\N \: trailing\`); got != "\n : trailing\\" {
+		t.Errorf("Unescape() = %q", got)
+	}
+}
@@ -22,12 +22,72 @@ export function updatePhoto(formData) {
   });
 }
 
-// List all Users
-export function listUsers() {
-  return axios.get('/users');
+/**
+ * Search the user directory, one page at a time.
+ * @param {Object} params - Optional q (username or part of it), limit and cursor (the nextCursor of the previous page).
+ * @returns {Promise} - Axios response with users and, unless it is the last page, nextCursor.
+ */
+export function listUsers(params = {}) {
+  return axios.get('/users', { params });
+}
+
+export function getPrivacySettings() {
+  return axios.get('/user/privacy');
+}
+
+/**
+ * Change who may see the user's photo, last seen time and read receipts, and who may start a chat with them.
+ * @param {Object} settings - Any of photo, lastSeen, readReceipts and messages, each "everyone", "contacts" or "nobody".
+ * @returns {Promise} - Axios response with all the settings.
+ */
+export function updatePrivacySettings(settings) {
+  return axios.put('/user/privacy', settings);
+}
+
+export function blockUser(userId) {
+  return axios.post(`/users/${userId}/block`);
+}
+
+export function unblockUser(userId) {
+  return axios.delete(`/users/${userId}/block`);
+}
+
+export function listBlockedUsers() {
+  return axios.get('/user/blocked');
+}
+
+export function listContacts() {
+  return axios.get('/contacts');
+}
+
+/**
+ * Add a user to the contacts list, or update the nickname and favorite flag of a contact.
+ * @param {string} userId - The user to save.
+ * @param {string} nickname - The private name to show for them, or "" for their username.
+ * @param {boolean} favorite - Whether to list them first.
+ * @returns {Promise} - Axios response with the saved contact.
+ */
+export function saveContact(userId, nickname, favorite) {
+  return axios.post('/contacts', { userId, nickname, favorite });
+}
+
+export function deleteContact(userId) {
+  return axios.delete(`/contacts/${userId}`);
 }
 
 // Conversations
+export function listMessageRequests() {
+  return axios.get('/requests');
+}
+
+export function acceptMessageRequest(conversationId) {
+  return axios.post(`/requests/${conversationId}/accept`);
+}
+
+export function declineMessageRequest(conversationId) {
+  return axios.post(`/requests/${conversationId}/decline`);
+}
+
 export function getMyConversations() {
   return axios.get('/conversation/myconversations');
 }
@@ -56,8 +116,37 @@ export async function getConversations() {
 }
 
 // Messaging Endpoints
-export function sendMessage({ conversationId, receiverId, content, isGroup, groupId, replyTo }) {
-  return axios.post('/messages', { conversationId, receiverId, content, isGroup, groupId, replyTo });
+export function sendMessage({ conversationId, receiverId, type, content, format, payload, attachmentId, isGroup, groupId, replyTo }) {
+  return axios.post('/messages', { conversationId, receiverId, type, content, format, payload, attachmentId, isGroup, groupId, replyTo });
+}
+
+/**
+ * Move or stop a live location shared by the current user.
+ * @param {string} messageId - The ID of the live location message.
+ * @param {object} update - latitude, longitude and accuracy, or stop: true.
+ * @returns {Promise} Axios promise.
+ */
+export async function updateLiveLocation(messageId, update) {
+  return axios.put(`/messages/${messageId}/location`, update);
+}
+
+/**
+ * Get the current user's draft in a conversation.
+ * @param {string} conversationId - The ID of the conversation.
+ * @returns {Promise} Axios promise; 404 when there is no draft.
+ */
+export async function getDraft(conversationId) {
+  return axios.get(`/conversations/${conversationId}/draft`);
+}
+
+/**
+ * Save the current user's draft in a conversation. An empty draft deletes it.
+ * @param {string} conversationId - The ID of the conversation.
+ * @param {object} draft - The draft: text, replyTo and attachments.
+ * @returns {Promise} Axios promise.
+ */
+export async function saveDraft(conversationId, { text, replyTo, attachments }) {
+  return axios.put(`/conversations/${conversationId}/draft`, { text, replyTo, attachments });
 }
 
 export function forwardMessageApi(messageId, targetConversationId) {
@@ -68,7 +157,46 @@ export function forwardMessageApi(messageId, targetConversationId) {
 }
 
 export async function commentMessage(messageId, reaction) {
-  return axios.post(`/messages/${messageId}/comments`, { reaction });
+  return axios.post(`/messages/${messageId}/reactions`, { reaction });
+}
+
+/**
+ * Add a text comment to a message.
+ * @param {string} messageId - The ID of the message.
+ * @param {string} content - The comment text.
+ * @returns {Promise} Axios promise.
+ */
+export async function addComment(messageId, content) {
+  return axios.post(`/messages/${messageId}/comments`, { content });
+}
+
+/**
+ * Delete one of the current user's comments.
+ * @param {string} messageId - The ID of the message.
+ * @param {string} commentId - The ID of the comment.
+ * @returns {Promise} Axios promise.
+ */
+export async function deleteComment(messageId, commentId) {
+  return axios.delete(`/messages/${messageId}/comments/${commentId}`);
+}
+
+/**
+ * Remove one of the current user's reactions from a message.
+ * @param {string} messageId - The ID of the message.
+ * @param {string} reaction - The emoji to remove.
+ * @returns {Promise} Axios promise.
+ */
+export async function removeReaction(messageId, reaction) {
+  return axios.delete(`/messages/${messageId}/reactions/${encodeURIComponent(reaction)}`);
+}
+
+/**
+ * List who reacted to a message.
+ * @param {string} messageId - The ID of the message.
+ * @returns {Promise} Axios promise.
+ */
+export async function getReactions(messageId) {
+  return axios.get(`/messages/${messageId}/reactions`);
 }
 
 /**
@@ -123,6 +251,99 @@ export async function uploadImage(formData) {
   });
 }
 
+/**
+ * Upload an Ogg/Opus or WAV file for an audio message.
+ * @param {FormData} formData - FormData containing the "audio" file.
+ * @returns {Promise} - Axios response with the attachment, including url, durationMs and waveform.
+ */
+export async function uploadAudio(formData) {
+  return axios.post('/media/audio', formData, {
+    headers: { 'Content-Type': 'multipart/form-data' }
+  });
+}
+
+// Size of the chunks sent by uploadFile; small enough to arrive within the server's request timeout.
+const UPLOAD_CHUNK_SIZE = 1 << 20;
+
+/**
+ * Upload a file in chunks, resuming after failed chunks, and turn it into an attachment.
+ * @param {File} file - The file to upload.
+ * @param {function} [onProgress] - Called with the fraction of the file sent so far.
+ * @returns {Promise} - Axios response with the attachment, whose id goes in attachmentId of a message.
+ */
+export async function uploadFile(file, onProgress) {
+  const created = await axios.post('/media/uploads', {
+    filename: file.name,
+    mimeType: file.type,
+    size: file.size
+  });
+  const location = `/media/uploads/${created.data.id}`;
+  let offset = 0;
+  let retries = 0;
+  while (offset < file.size) {
+    try {
+      const res = await axios.patch(location, file.slice(offset, offset + UPLOAD_CHUNK_SIZE), {
+        headers: { 'Content-Type': 'application/offset+octet-stream', 'Upload-Offset': String(offset) }
+      });
+      offset = Number(res.headers['upload-offset']);
+      retries = 0;
+    } catch (err) {
+      if (++retries > 3 || (err.response && err.response.status !== 409 && err.response.status < 500)) {
+        throw err;
+      }
+      // Ask the server where to resume.
+      const status = await axios.head(location);
+      offset = Number(status.headers['upload-offset']);
+    }
+    if (onProgress) onProgress(offset / file.size);
+  }
+  return axios.post(`${location}/finalize`);
+}
+
+export function createStickerPack(name) {
+  return axios.post('/sticker-packs', { name });
+}
+
+/**
+ * Add a sticker to one of the user's packs.
+ * @param {string} packId - The pack's ID.
+ * @param {File} image - A PNG or WebP image of at most 512 KiB.
+ * @param {string[]} emojis - The emoji the sticker is found by.
+ * @returns {Promise} - Axios response with the sticker.
+ */
+export function addSticker(packId, image, emojis) {
+  const formData = new FormData();
+  formData.append('sticker', image);
+  formData.append('emojis', emojis.join(','));
+  return axios.post(`/sticker-packs/${packId}/stickers`, formData, {
+    headers: { 'Content-Type': 'multipart/form-data' }
+  });
+}
+
+export function getInstalledStickerPacks() {
+  return axios.get('/user/sticker-packs');
+}
+
+export function installStickerPack(packId) {
+  return axios.put(`/user/sticker-packs/${packId}`);
+}
+
+export function uninstallStickerPack(packId) {
+  return axios.delete(`/user/sticker-packs/${packId}`);
+}
+
+export function getSharedStickerPacks(conversationId) {
+  return axios.get(`/conversations/${conversationId}/sticker-packs`);
+}
+
+export function shareStickerPack(conversationId, packId) {
+  return axios.post(`/conversations/${conversationId}/sticker-packs`, { packId });
+}
+
+export function searchStickers(emoji) {
+  return axios.get('/stickers/search', { params: { emoji } });
+}
+
 /**
  * Upload a new group photo.
  * @param {string} groupId - The group's ID.